@@ -24,6 +24,12 @@ func NewAggregate() (*Aggregate, error) {
 	}, nil
 }
 
+//AggregateRoot returns the aggregate itself, giving access to the embedded aggregate
+//data of the domain objects that embed it.
+func (a *Aggregate) AggregateRoot() *Aggregate {
+	return a
+}
+
 //GenerateID generates a unique ID using UUID v4.
 func GenerateID() (string, error) {
 	u, err := uuid.GenerateUuidV4()
@@ -0,0 +1,142 @@
+//Package aggtest provides a Given/When/Then kit for testing event sourced aggregates.
+//
+//A test gives the events in the aggregate's history, runs a command against the
+//aggregate rebuilt from them, then states the events the command should produce, or
+//the error it should fail with:
+//
+//	aggtest.For(t, newUser).
+//		Given(sample.UserCreated{FirstName: "joe"}).
+//		When(func(u *sample.User) error { return u.UpdateFirstName("bob") }).
+//		Then(sample.UserFirstNameUpdated{OldFirst: "joe", NewFirst: "bob"})
+//
+//Events are compared by payload, and differences are reported with a diff of the
+//expected and produced payloads.
+package aggtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+)
+
+//Scenario is a Given/When/Then test of an aggregate of type T.
+type Scenario[T goes.EventSourcedAggregate] struct {
+	t       testing.TB
+	factory func() T
+	given   []goes.Event
+	agg     T
+	base    int
+	err     error
+	ran     bool
+}
+
+//For starts a scenario for aggregates created by the factory, which must return a new,
+//empty aggregate with its embedded Aggregate allocated.
+func For[T goes.EventSourcedAggregate](t testing.TB, factory func() T) *Scenario[T] {
+	return &Scenario[T]{t: t, factory: factory}
+}
+
+//Given sets the history of the aggregate. Each item is either the payload of an
+//event, or a goes.Event; the events are numbered from version 1 in the order given.
+func (s *Scenario[T]) Given(events ...interface{}) *Scenario[T] {
+	for _, e := range events {
+		event, ok := e.(goes.Event)
+		if !ok {
+			event = goes.Event{Payload: e}
+		}
+		event.Version = len(s.given) + 1
+		s.given = append(s.given, event)
+	}
+	return s
+}
+
+//When rebuilds the aggregate from the given history and runs the command against it.
+func (s *Scenario[T]) When(command func(T) error) *Scenario[T] {
+	s.t.Helper()
+
+	s.agg = s.factory()
+	root := s.agg.AggregateRoot()
+	if root.AggregateID == "" {
+		id, err := goes.GenerateID()
+		if err != nil {
+			s.t.Fatalf("Generating aggregate id: %v", err)
+		}
+		root.AggregateID = id
+	}
+
+	for _, e := range s.given {
+		e.Source = root.AggregateID
+		root.Version++
+		if err := s.agg.Route(e); err != nil {
+			s.t.Fatalf("Applying given event %d: %v", e.Version, err)
+		}
+	}
+	root.Events = nil
+
+	s.base = root.Version
+	s.err = command(s.agg)
+	s.ran = true
+	return s
+}
+
+//Then checks the command succeeded and produced events with the expected payloads, in
+//order. Each item is either a payload or a goes.Event whose payload is compared. The
+//aggregate is returned for further checks of its state.
+func (s *Scenario[T]) Then(expected ...interface{}) T {
+	s.t.Helper()
+	s.checkRan()
+
+	if s.err != nil {
+		s.t.Errorf("Command failed: %v", s.err)
+		return s.agg
+	}
+
+	produced := s.agg.AggregateRoot().Events
+	expectedPayloads := make([]interface{}, len(expected))
+	for i, e := range expected {
+		if event, ok := e.(goes.Event); ok {
+			e = event.Payload
+		}
+		expectedPayloads[i] = e
+	}
+
+	producedPayloads := make([]interface{}, len(produced))
+	for i, e := range produced {
+		producedPayloads[i] = e.Payload
+		if e.Version != s.base+i+1 {
+			s.t.Errorf("Produced event %d has version %d, expected %d", i+1, e.Version, s.base+i+1)
+		}
+	}
+
+	assert.Equal(s.t, expectedPayloads, producedPayloads, "Events produced by the command")
+	return s.agg
+}
+
+//ThenError checks the command failed with an error matching expected, as determined
+//by errors.Is, and produced no events.
+func (s *Scenario[T]) ThenError(expected error) {
+	s.t.Helper()
+	s.checkRan()
+
+	if s.err == nil {
+		s.t.Errorf("Command succeeded, expected error %v", expected)
+		return
+	}
+
+	if !errors.Is(s.err, expected) {
+		s.t.Errorf("Command failed with %v, expected error %v", s.err, expected)
+	}
+
+	if len(s.agg.AggregateRoot().Events) > 0 {
+		s.t.Errorf("Failed command produced %d events", len(s.agg.AggregateRoot().Events))
+	}
+}
+
+func (s *Scenario[T]) checkRan() {
+	s.t.Helper()
+	if !s.ran {
+		s.t.Fatalf("No command run: call When before Then")
+	}
+}
@@ -0,0 +1,70 @@
+package aggtest_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/aggtest"
+	"github.com/xtracdev/goes/sample"
+)
+
+func newUser() *sample.User {
+	return &sample.User{Aggregate: new(goes.Aggregate)}
+}
+
+func TestCommandProducesEvents(t *testing.T) {
+	user := aggtest.For(t, newUser).
+		Given(sample.UserCreated{FirstName: "joe", LastName: "bloggs"}).
+		When(func(u *sample.User) error { return u.UpdateFirstName("bob") }).
+		Then(sample.UserFirstNameUpdated{OldFirst: "joe", NewFirst: "bob"})
+
+	if user.FirstName != "bob" {
+		t.Errorf("Expected first name bob, got %s", user.FirstName)
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	errRejected := errors.New("rejected")
+	aggtest.For(t, newUser).
+		Given(sample.UserCreated{FirstName: "joe"}).
+		When(func(u *sample.User) error { return fmt.Errorf("updating: %w", errRejected) }).
+		ThenError(errRejected)
+}
+
+//recordingT records the failures reported to it instead of failing the test.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Name() string { return "recording" }
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestMismatchIsReported(t *testing.T) {
+	rt := new(recordingT)
+	aggtest.For(rt, newUser).
+		Given(sample.UserCreated{FirstName: "joe"}).
+		When(func(u *sample.User) error { return u.UpdateFirstName("bob") }).
+		Then(sample.UserFirstNameUpdated{OldFirst: "joe", NewFirst: "fred"})
+
+	if len(rt.failures) != 1 {
+		t.Fatalf("Expected one failure, got %v", rt.failures)
+	}
+
+	rt = new(recordingT)
+	aggtest.For(rt, newUser).
+		Given(sample.UserCreated{FirstName: "joe"}).
+		When(func(u *sample.User) error { return nil }).
+		ThenError(errors.New("expected"))
+
+	if len(rt.failures) != 1 {
+		t.Fatalf("Expected one failure, got %v", rt.failures)
+	}
+}
@@ -0,0 +1,388 @@
+//Package archive defines a portable archive format for the events in a store, for
+//moving events between store implementations and seeding test fixtures.
+//
+//An archive is a sequence of JSON documents, one per line, optionally gzip
+//compressed. The first line holds the header, each following line holds an event, and
+//the last line holds the manifest:
+//
+//	{"header":{"format":"goes-archive","formatVersion":1,"createdAt":"..."}}
+//	{"event":{"aggregateId":"...","version":1,"typeCode":"...","payload":"<base64>",...}}
+//	{"manifest":{"events":1,"aggregates":1,"sha256":"..."}}
+//
+//Events appear in the order they were stored, so the events of each aggregate are in
+//version order. The manifest's checksum is the SHA-256 of every line before it, as
+//written, so a damaged or truncated archive is detected before anything is imported.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+//Format identifies an event archive in its header.
+const Format = "goes-archive"
+
+//FormatVersion is the version of the archive format written by Export. Import reads
+//archives written with this version or earlier.
+const FormatVersion = 1
+
+var (
+	//ErrNotArchive is returned when importing data that does not start with an
+	//archive header.
+	ErrNotArchive = errors.New("Not an event archive")
+
+	//ErrUnsupportedVersion is returned when importing an archive written with a later
+	//version of the format.
+	ErrUnsupportedVersion = errors.New("Unsupported archive format version")
+
+	//ErrCorruptArchive is returned when an archive is truncated or malformed, or does
+	//not match its manifest.
+	ErrCorruptArchive = errors.New("Corrupt event archive")
+
+	//ErrNotLogReader is returned when exporting a store that does not implement
+	//goes.EventLogReader, and so cannot list its events.
+	ErrNotLogReader = errors.New("Event store does not keep a global log")
+
+	//ErrPayloadNotSerialized is returned when exporting an event whose payload is not a
+	//[]byte and there is no codec to serialize it.
+	ErrPayloadNotSerialized = errors.New("Event payload is not serialized")
+)
+
+//Header is the first line of an archive.
+type Header struct {
+	Format        string    `json:"format"`
+	FormatVersion int       `json:"formatVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+//Record is an event in an archive. The payload is serialized, and encoded as base64
+//in the JSON.
+type Record struct {
+	AggregateID   string            `json:"aggregateId"`
+	Version       int               `json:"version"`
+	TypeCode      string            `json:"typeCode"`
+	SchemaVersion int               `json:"schemaVersion,omitempty"`
+	EventID       string            `json:"eventId,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+	CausationID   string            `json:"causationId,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Payload       []byte            `json:"payload"`
+}
+
+//Manifest is the last line of an archive, summarizing its contents.
+type Manifest struct {
+	Events     int    `json:"events"`
+	Aggregates int    `json:"aggregates"`
+	SHA256     string `json:"sha256"`
+}
+
+//line is a line of an archive, holding one of its parts.
+type line struct {
+	Header   *Header   `json:"header,omitempty"`
+	Event    *Record   `json:"event,omitempty"`
+	Manifest *Manifest `json:"manifest,omitempty"`
+}
+
+//logPageSize is the number of events read from the global log at a time.
+const logPageSize = 1000
+
+//ExportConfig configures an export.
+type ExportConfig struct {
+	//Gzip compresses the archive.
+	Gzip bool
+	//Codec serializes the payloads of events read from a store holding deserialized
+	//payloads.
+	Codec goes.EventCodec
+}
+
+//lineWriter writes the lines of an archive, hashing everything it writes.
+type lineWriter struct {
+	w    io.Writer
+	hash hash.Hash
+}
+
+func (lw *lineWriter) write(l line) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if l.Manifest == nil {
+		lw.hash.Write(data)
+	}
+	_, err = lw.w.Write(data)
+	return err
+}
+
+//Export writes every event in the store to w as an archive, in the order the events
+//were stored, and returns the archive's manifest. The store must implement
+//goes.EventLogReader.
+func Export(w io.Writer, store goes.EventStore, config ExportConfig) (Manifest, error) {
+	logReader, ok := store.(goes.EventLogReader)
+	if !ok {
+		return Manifest{}, ErrNotLogReader
+	}
+
+	out := w
+	var zw *gzip.Writer
+	if config.Gzip {
+		zw = gzip.NewWriter(w)
+		out = zw
+	}
+	buffered := bufio.NewWriter(out)
+	lw := &lineWriter{w: buffered, hash: sha256.New()}
+
+	header := Header{Format: Format, FormatVersion: FormatVersion, CreatedAt: time.Now().UTC()}
+	if err := lw.write(line{Header: &header}); err != nil {
+		return Manifest{}, err
+	}
+
+	var manifest Manifest
+	aggregates := make(map[string]bool)
+	for from := int64(1); ; {
+		page, err := logReader.ReadEventLog(from, logPageSize)
+		if err != nil {
+			return Manifest{}, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, e := range page {
+			record, err := toRecord(e, config.Codec)
+			if err != nil {
+				return Manifest{}, err
+			}
+			if err := lw.write(line{Event: &record}); err != nil {
+				return Manifest{}, err
+			}
+			manifest.Events++
+			aggregates[e.Source] = true
+		}
+		from = page[len(page)-1].Position + 1
+	}
+
+	manifest.Aggregates = len(aggregates)
+	manifest.SHA256 = hex.EncodeToString(lw.hash.Sum(nil))
+	if err := lw.write(line{Manifest: &manifest}); err != nil {
+		return Manifest{}, err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return Manifest{}, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	return manifest, nil
+}
+
+//toRecord converts an event to its archive form, serializing the payload with the
+//codec if it is not already serialized.
+func toRecord(e goes.Event, codec goes.EventCodec) (Record, error) {
+	if codec != nil {
+		var err error
+		if e, err = codec.EncodeEvent(e); err != nil {
+			return Record{}, err
+		}
+	}
+
+	payload, ok := e.Payload.([]byte)
+	if !ok && e.Payload != nil {
+		return Record{}, fmt.Errorf("%w: event %s has a %T payload", ErrPayloadNotSerialized, e.EventID, e.Payload)
+	}
+
+	return Record{
+		AggregateID:   e.Source,
+		Version:       e.Version,
+		TypeCode:      e.TypeCode,
+		SchemaVersion: e.SchemaVersion,
+		EventID:       e.EventID,
+		Timestamp:     e.Timestamp,
+		CorrelationID: e.CorrelationID,
+		CausationID:   e.CausationID,
+		Headers:       e.Headers,
+		Payload:       payload,
+	}, nil
+}
+
+//event converts the record back to an event.
+func (r Record) event() goes.Event {
+	e := goes.Event{
+		Source:        r.AggregateID,
+		Version:       r.Version,
+		TypeCode:      r.TypeCode,
+		SchemaVersion: r.SchemaVersion,
+		EventID:       r.EventID,
+		Timestamp:     r.Timestamp,
+		CorrelationID: r.CorrelationID,
+		CausationID:   r.CausationID,
+		Headers:       r.Headers,
+	}
+	if r.Payload != nil {
+		e.Payload = r.Payload
+	}
+	return e
+}
+
+//ImportConfig configures an import.
+type ImportConfig struct {
+	//DryRun validates the archive against the store without storing anything.
+	DryRun bool
+}
+
+//Import reads an archive from r, compressed or not, and stores its events, keeping
+//their versions and metadata; the store assigns them new log positions. It returns the
+//archive's manifest.
+//
+//The whole archive is read and validated before anything is stored: it must match its
+//manifest, and the events of each aggregate must have consecutive versions following
+//on from the version already in the store. Events that break version continuity are
+//reported with an error wrapping goes.ErrEventSequence.
+//
+//Consecutive events for the same aggregate are stored together, so if the store fails
+//part way through, the events of the aggregates stored before the failure remain.
+func Import(r io.Reader, store goes.EventStore, config ImportConfig) (Manifest, error) {
+	records, manifest, err := read(r)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	if err := checkContinuity(records, store); err != nil {
+		return manifest, err
+	}
+	if config.DryRun {
+		return manifest, nil
+	}
+
+	var agg *goes.Aggregate
+	for i, record := range records {
+		if agg == nil || agg.AggregateID != record.AggregateID {
+			agg = &goes.Aggregate{AggregateID: record.AggregateID}
+		}
+		agg.Events = append(agg.Events, record.event())
+		agg.Version = record.Version
+
+		if i+1 < len(records) && records[i+1].AggregateID == agg.AggregateID {
+			continue
+		}
+		if err := store.StoreEvents(agg); err != nil {
+			return manifest, fmt.Errorf("Storing events for aggregate %s: %w", agg.AggregateID, err)
+		}
+	}
+
+	return manifest, nil
+}
+
+//read reads and validates an archive, returning its events and manifest.
+func read(r io.Reader) ([]Record, Manifest, error) {
+	in := bufio.NewReader(r)
+	//Compressed archives start with the gzip magic number
+	if magic, err := in.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, Manifest{}, fmt.Errorf("%w: %v", ErrCorruptArchive, err)
+		}
+		defer zr.Close()
+		in = bufio.NewReader(zr)
+	}
+
+	hash := sha256.New()
+	var records []Record
+	var manifest *Manifest
+	for n := 1; ; n++ {
+		data, err := in.ReadBytes('\n')
+		if err == io.EOF && len(data) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, Manifest{}, fmt.Errorf("%w: %v", ErrCorruptArchive, err)
+		}
+
+		var l line
+		if err := json.Unmarshal(data, &l); err != nil {
+			if n == 1 {
+				return nil, Manifest{}, ErrNotArchive
+			}
+			return nil, Manifest{}, fmt.Errorf("%w: line %d: %v", ErrCorruptArchive, n, err)
+		}
+
+		switch {
+		case manifest != nil:
+			return nil, Manifest{}, fmt.Errorf("%w: line %d follows the manifest", ErrCorruptArchive, n)
+		case n == 1:
+			if l.Header == nil || l.Header.Format != Format {
+				return nil, Manifest{}, ErrNotArchive
+			}
+			if l.Header.FormatVersion > FormatVersion {
+				return nil, Manifest{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, l.Header.FormatVersion)
+			}
+		case l.Event != nil:
+			records = append(records, *l.Event)
+		case l.Manifest != nil:
+			manifest = l.Manifest
+			continue
+		default:
+			return nil, Manifest{}, fmt.Errorf("%w: line %d is not an event", ErrCorruptArchive, n)
+		}
+		hash.Write(data)
+	}
+
+	if manifest == nil {
+		return nil, Manifest{}, fmt.Errorf("%w: no manifest, the archive may be truncated", ErrCorruptArchive)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != manifest.SHA256 {
+		return nil, Manifest{}, fmt.Errorf("%w: checksum %s does not match manifest", ErrCorruptArchive, sum)
+	}
+
+	aggregates := make(map[string]bool)
+	for _, record := range records {
+		aggregates[record.AggregateID] = true
+	}
+	if len(records) != manifest.Events || len(aggregates) != manifest.Aggregates {
+		return nil, Manifest{}, fmt.Errorf("%w: %d events for %d aggregates, manifest lists %d for %d",
+			ErrCorruptArchive, len(records), len(aggregates), manifest.Events, manifest.Aggregates)
+	}
+
+	return records, *manifest, nil
+}
+
+//checkContinuity checks the events of each aggregate have consecutive versions,
+//following on from the version stored.
+func checkContinuity(records []Record, store goes.EventStore) error {
+	versions := make(map[string]int)
+	for _, record := range records {
+		current, ok := versions[record.AggregateID]
+		if !ok {
+			stored, err := store.RetrieveEvents(record.AggregateID)
+			if err != nil && !errors.Is(err, goes.ErrAggregateNotFound) {
+				return err
+			}
+			if len(stored) > 0 {
+				current = stored[len(stored)-1].Version
+			}
+		}
+
+		if record.Version != current+1 {
+			return fmt.Errorf("%w: aggregate %s event has version %d, expected %d",
+				goes.ErrEventSequence, record.AggregateID, record.Version, current+1)
+		}
+		versions[record.AggregateID] = record.Version
+	}
+	return nil
+}
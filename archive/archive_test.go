@@ -0,0 +1,138 @@
+package archive_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/archive"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+)
+
+//newSourceStore returns an in memory store holding a user with two events, and a
+//second user.
+func newSourceStore(t *testing.T) (*inmemes.InMemoryEventStore, *sample.User) {
+	store := inmemes.NewInMemoryEventStore()
+
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	user.UpdateFirstName("updated")
+	assert.Nil(t, user.Store(store))
+
+	other, err := sample.NewUser("other", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, other.Store(store))
+
+	return store, user
+}
+
+func export(t *testing.T, store goes.EventStore, config archive.ExportConfig) []byte {
+	var buf bytes.Buffer
+	manifest, err := archive.Export(&buf, store, config)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, manifest.Events)
+	assert.Equal(t, 2, manifest.Aggregates)
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		source, user := newSourceStore(t)
+		data := export(t, source, archive.ExportConfig{Gzip: compressed, Codec: sample.Codecs})
+
+		target, err := filestore.NewFileEventStore(t.TempDir())
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer target.Close()
+
+		manifest, err := archive.Import(bytes.NewReader(data), target, archive.ImportConfig{})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, manifest.Events)
+
+		//Versions and metadata are kept
+		original, err := source.RetrieveEvents(user.AggregateID)
+		assert.Nil(t, err)
+		imported, err := target.RetrieveEvents(user.AggregateID)
+		assert.Nil(t, err)
+		if assert.Len(t, imported, 2) {
+			for i := range original {
+				assert.Equal(t, original[i].Version, imported[i].Version)
+				assert.Equal(t, original[i].EventID, imported[i].EventID)
+				assert.Equal(t, original[i].CorrelationID, imported[i].CorrelationID)
+				assert.True(t, original[i].Timestamp.Equal(imported[i].Timestamp))
+			}
+		}
+
+		loaded, err := sample.NewUserRepository(target.WithCodec(sample.Codecs)).Load(user.AggregateID)
+		assert.Nil(t, err)
+		assert.Equal(t, "updated", loaded.FirstName)
+	}
+}
+
+func TestDryRunChecksVersionContinuity(t *testing.T) {
+	source, _ := newSourceStore(t)
+	data := export(t, source, archive.ExportConfig{Codec: sample.Codecs})
+
+	target := inmemes.NewInMemoryEventStore()
+	_, err := archive.Import(bytes.NewReader(data), target, archive.ImportConfig{DryRun: true})
+	assert.Nil(t, err)
+	head, _ := target.HeadPosition()
+	assert.Equal(t, int64(0), head, "dry run stored events")
+
+	//Importing the same events twice would break the versioning of the aggregates
+	_, err = archive.Import(bytes.NewReader(data), target, archive.ImportConfig{})
+	assert.Nil(t, err)
+	_, err = archive.Import(bytes.NewReader(data), target, archive.ImportConfig{DryRun: true})
+	assert.True(t, errors.Is(err, goes.ErrEventSequence))
+}
+
+func TestDetectsDamage(t *testing.T) {
+	source, user := newSourceStore(t)
+	data := string(export(t, source, archive.ExportConfig{Codec: sample.Codecs}))
+	lines := strings.SplitAfter(data, "\n")
+
+	tests := []struct {
+		name    string
+		archive string
+		err     error
+	}{
+		{"NotArchive", "{\"event\":{}}\n", archive.ErrNotArchive},
+		{"Truncated", strings.Join(lines[:3], ""), archive.ErrCorruptArchive},
+		{"Tampered", strings.Replace(data, user.AggregateID, "someone-else", 1), archive.ErrCorruptArchive},
+		{"LaterVersion", strings.Replace(data, `"formatVersion":1`, `"formatVersion":2`, 1), archive.ErrUnsupportedVersion},
+		{"MissingEvent", strings.Join(append(lines[:1], lines[2:]...), ""), archive.ErrCorruptArchive},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			target := inmemes.NewInMemoryEventStore()
+			_, err := archive.Import(strings.NewReader(tc.archive), target, archive.ImportConfig{})
+			assert.True(t, errors.Is(err, tc.err), "%v", err)
+
+			head, _ := target.HeadPosition()
+			assert.Equal(t, int64(0), head)
+		})
+	}
+}
+
+func TestExportNeedsEventLog(t *testing.T) {
+	store := struct{ goes.EventStore }{inmemes.NewInMemoryEventStore()}
+	_, err := archive.Export(&bytes.Buffer{}, store, archive.ExportConfig{})
+	assert.Equal(t, archive.ErrNotLogReader, err)
+}
+
+func TestExportNeedsSerializedPayloads(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+
+	_, err = archive.Export(&bytes.Buffer{}, store, archive.ExportConfig{})
+	assert.True(t, errors.Is(err, archive.ErrPayloadNotSerialized))
+}
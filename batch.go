@@ -0,0 +1,76 @@
+package goes
+
+import "fmt"
+
+//BatchStore defines the methods offered by an event store that can store the events of
+//several aggregates in a single all or nothing write. The events of each aggregate must
+//follow on from its stored version as they would for StoreEvents; if the check fails for
+//any aggregate, nothing is stored. The events are published only once all of them have
+//been stored. An aggregate may appear in a batch only once.
+type BatchStore interface {
+	StoreBatch(aggs ...*Aggregate) error
+}
+
+//CheckBatch returns an error wrapping ErrDuplicateAggregate if an aggregate appears more
+//than once in the batch.
+func CheckBatch(aggs []*Aggregate) error {
+	seen := make(map[string]bool, len(aggs))
+	for _, agg := range aggs {
+		if seen[agg.AggregateID] {
+			return fmt.Errorf("%w: %s", ErrDuplicateAggregate, agg.AggregateID)
+		}
+		seen[agg.AggregateID] = true
+	}
+	return nil
+}
+
+//UnitOfWork collects the aggregates changed by a command, so their events can be
+//committed to a BatchStore together. Payloads are stored as they are held by the
+//aggregates, so any encoding must be done by the store's codec.
+type UnitOfWork struct {
+	aggregates []EventSourcedAggregate
+}
+
+//NewUnitOfWork creates a unit of work holding the given aggregates.
+func NewUnitOfWork(aggs ...EventSourcedAggregate) *UnitOfWork {
+	return &UnitOfWork{aggregates: aggs}
+}
+
+//Add adds aggregates to the unit of work.
+func (u *UnitOfWork) Add(aggs ...EventSourcedAggregate) *UnitOfWork {
+	u.aggregates = append(u.aggregates, aggs...)
+	return u
+}
+
+//Commit stores the uncommitted events of every aggregate in the unit of work in a single
+//batch, then clears the events from the aggregates. Aggregates with no uncommitted
+//events are left out of the batch. If the batch cannot be stored, nothing is stored and
+//the aggregates keep their events.
+func (u *UnitOfWork) Commit(store EventStore) error {
+	batchStore, ok := store.(BatchStore)
+	if !ok {
+		return ErrBatchNotSupported
+	}
+
+	var roots []*Aggregate
+	for _, agg := range u.aggregates {
+		if root := agg.AggregateRoot(); len(root.Events) > 0 {
+			roots = append(roots, root)
+		}
+	}
+
+	if len(roots) == 0 {
+		return nil
+	}
+
+	if err := batchStore.StoreBatch(roots...); err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		root.Events = nil
+	}
+	u.aggregates = nil
+
+	return nil
+}
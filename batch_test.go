@@ -0,0 +1,46 @@
+package goes_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+)
+
+func TestUnitOfWorkCommitsAtomically(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	joe, err := sample.NewUser("joe", "bloggs", "joe@example.com")
+	assert.Nil(t, err)
+	jane, err := sample.NewUser("jane", "doe", "jane@example.com")
+	assert.Nil(t, err)
+
+	assert.Nil(t, goes.NewUnitOfWork(joe, jane).Commit(store))
+	assert.Equal(t, 0, len(joe.Events))
+	assert.Equal(t, 0, len(jane.Events))
+
+	//A conflict on one aggregate leaves the other unchanged
+	stale := sample.NewUserFromHistory(nil)
+	stale.AggregateID = jane.AggregateID
+	assert.Nil(t, stale.UpdateFirstName("stale"))
+	assert.Nil(t, joe.UpdateFirstName("joseph"))
+
+	err = goes.NewUnitOfWork(joe).Add(stale).Commit(store)
+	assert.True(t, errors.Is(err, goes.ErrConcurrency))
+	assert.Equal(t, 1, len(joe.Events))
+
+	events, err := store.RetrieveEvents(joe.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+}
+
+func TestUnitOfWorkNeedsBatchStore(t *testing.T) {
+	user, err := sample.NewUser("joe", "bloggs", "joe@example.com")
+	assert.Nil(t, err)
+
+	//A store offering only the EventStore interface
+	store := struct{ goes.EventStore }{inmemes.NewInMemoryEventStore()}
+	assert.Equal(t, goes.ErrBatchNotSupported, goes.NewUnitOfWork(user).Commit(store))
+}
@@ -0,0 +1,222 @@
+//Package cli implements the goes command line tool, for inspecting and administering
+//event stores without writing code.
+//
+//The tool works against a file backed store, given with -dir, or a store served by
+//goes-server, given with -url. Commands that only read a file backed store open it read
+//only, so they can be used while another process, such as goes-server, writes to it.
+//Payloads are shown decoded by the codec the tool is built with; payloads the codec does
+//not know are shown as JSON if they are JSON, and base64 encoded otherwise. Services
+//with their own event types build their own copy of the tool by calling Run with a codec
+//registering those types.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/httpstore"
+)
+
+//logPageSize is the number of events read from the global log at a time.
+const logPageSize = 1000
+
+//pollInterval is how often tail checks a file backed store for new events.
+const pollInterval = 500 * time.Millisecond
+
+//ErrUsage is returned when the command line is not valid. The usage has already been
+//written to Stderr.
+var ErrUsage = errors.New("Invalid command line")
+
+//Config configures the tool.
+type Config struct {
+	//Codec decodes payloads for display. Payloads are shown undecoded if it is nil.
+	Codec goes.EventCodec
+	//Stdout receives the output of the commands.
+	Stdout io.Writer
+	//Stderr receives usage messages.
+	Stderr io.Writer
+}
+
+//command is a subcommand of the tool.
+type command struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, t *tool, args []string) error
+	//writes reports whether the command will store events given its arguments, in which
+	//case a file backed store is opened for writing. It is nil for commands that only
+	//read.
+	writes func(args []string) bool
+}
+
+//commands holds the subcommands by name. It is filled in by init, as the commands
+//refer back to it for their usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"aggregates": {"aggregates", "list the aggregates in the store", runAggregates, nil},
+		"dump":       {"dump [-from version] [-to version] aggregate-id", "show an aggregate's events", runDump, nil},
+		"tail":       {"tail [-from position] [-count n]", "show events as they are stored", runTail, nil},
+		"stats":      {"stats", "show statistics for the store", runStats, nil},
+		"export":     {"export [-gzip] file", "export every event in the store to an archive", runExport, nil},
+		"import":     {"import [-dry-run] file", "import the events in an archive into the store", runImport, importWrites},
+		"republish":  {"republish", "republish every event to a server's subscribers (needs -url)", runRepublish, nil},
+	}
+}
+
+//store is the interface the tool needs from a store.
+type store interface {
+	goes.EventStore
+	goes.EventLogReader
+}
+
+//tool holds the store a command runs against.
+type tool struct {
+	config Config
+	store  store
+	//remote is true for a store served by goes-server, which other processes share
+	remote bool
+}
+
+func usage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: goes (-dir directory | -url server-url) command [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-50s %s\n", commands[name].usage, commands[name].description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Options:")
+	global.SetOutput(w)
+	global.PrintDefaults()
+}
+
+//Run runs the tool with the command line arguments, not including the program name.
+//Commands that follow the store, such as tail, run until ctx is done.
+func Run(ctx context.Context, args []string, config Config) error {
+	if config.Stdout == nil {
+		config.Stdout = io.Discard
+	}
+	if config.Stderr == nil {
+		config.Stderr = io.Discard
+	}
+
+	global := flag.NewFlagSet("goes", flag.ContinueOnError)
+	global.SetOutput(config.Stderr)
+	dir := global.String("dir", "", "directory of a file backed store")
+	url := global.String("url", "", "URL of a goes-server")
+	global.Usage = func() { usage(config.Stderr, global) }
+	if err := global.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	if global.NArg() == 0 || (*dir == "") == (*url == "") {
+		global.Usage()
+		return ErrUsage
+	}
+
+	cmd, ok := commands[global.Arg(0)]
+	if !ok {
+		fmt.Fprintf(config.Stderr, "Unknown command %q\n\n", global.Arg(0))
+		global.Usage()
+		return ErrUsage
+	}
+
+	t := &tool{config: config}
+	if *url != "" {
+		client := httpstore.NewClient(*url, nil)
+		defer client.Close()
+		t.store, t.remote = client, true
+	} else {
+		readOnly := cmd.writes == nil || !cmd.writes(global.Args()[1:])
+		fs, err := filestore.NewFileEventStoreWithConfig(*dir, filestore.Config{ReadOnly: readOnly})
+		if err != nil {
+			return err
+		}
+		defer fs.Close()
+		t.store = fs
+	}
+
+	return cmd.run(ctx, t, global.Args()[1:])
+}
+
+//flags returns a flag set for the named command, printing its usage on error.
+func (t *tool) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(t.config.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(t.config.Stderr, "Usage: goes %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+//parse parses the command's arguments, checking the number of positional arguments.
+func (t *tool) parse(fs *flag.FlagSet, args []string, positional int) error {
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() != positional {
+		fs.Usage()
+		return ErrUsage
+	}
+	return nil
+}
+
+//eachEvent calls fn for each event in the global log from the given position.
+func (t *tool) eachEvent(from int64, fn func(goes.Event) error) error {
+	for {
+		page, err := t.store.ReadEventLog(from, logPageSize)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		for _, e := range page {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		from = page[len(page)-1].Position + 1
+	}
+}
+
+//payload returns the event's payload for display: decoded by the codec and shown as
+//JSON if possible, otherwise as the raw JSON or base64 encoded bytes.
+func (t *tool) payload(e goes.Event) string {
+	if t.config.Codec != nil {
+		if decoded, err := t.config.Codec.DecodeEvent(e); err == nil {
+			if _, raw := decoded.Payload.([]byte); !raw {
+				return formatJSON(decoded.Payload)
+			}
+		}
+	}
+
+	data, ok := e.Payload.([]byte)
+	if !ok {
+		return formatJSON(e.Payload)
+	}
+	return formatRaw(data)
+}
+
+//requireRemote returns an error explaining the command needs a server.
+func (t *tool) requireRemote(name string) error {
+	if t.remote {
+		return nil
+	}
+	return fmt.Errorf("goes %s needs -url: a file store has no subscribers outside the process that opened it", name)
+}
@@ -0,0 +1,206 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/cli"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/httpstore"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+)
+
+//run runs the tool, returning its output.
+func run(t *testing.T, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := cli.Run(context.Background(), args, cli.Config{Codec: sample.Codecs, Stdout: &stdout, Stderr: &stderr})
+	return stdout.String(), err
+}
+
+//storeUsers stores a user with an updated first name, and a second user.
+func storeUsers(t *testing.T, store goes.EventStore) (*sample.User, *sample.User) {
+	first, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	first.UpdateFirstName("updated")
+	assert.Nil(t, first.Store(store))
+
+	second, err := sample.NewUser("second", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, second.Store(store))
+
+	return first, second
+}
+
+//newFileStore creates a file store holding the sample users, returning its directory.
+func newFileStore(t *testing.T) (string, *sample.User, *sample.User) {
+	dir := t.TempDir()
+	store, err := filestore.NewFileEventStore(dir)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	first, second := storeUsers(t, store.WithCodec(sample.Codecs))
+	assert.Nil(t, store.Close())
+	return dir, first, second
+}
+
+func TestInspectFileStore(t *testing.T) {
+	dir, first, second := newFileStore(t)
+
+	out, err := run(t, "-dir", dir, "aggregates")
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{first.AggregateID, "2", "2"}, strings.Fields(lines[1])[:3])
+		assert.Equal(t, []string{second.AggregateID, "1", "1"}, strings.Fields(lines[2])[:3])
+	}
+
+	out, err = run(t, "-dir", dir, "dump", "-from", "2", first.AggregateID)
+	assert.Nil(t, err)
+	assert.Contains(t, out, sample.UserFirstNameUpdatedTypeCode)
+	assert.Contains(t, out, `"NewFirst":"updated"`)
+	assert.NotContains(t, out, sample.UserCreatedTypeCode)
+
+	out, err = run(t, "-dir", dir, "stats")
+	assert.Nil(t, err)
+	assert.Regexp(t, `Head position:\s+3`, out)
+	assert.Regexp(t, `Aggregates:\s+2`, out)
+	assert.Regexp(t, sample.UserCreatedTypeCode+`\s+2`, out)
+}
+
+func TestExportImport(t *testing.T) {
+	dir, first, _ := newFileStore(t)
+	file := filepath.Join(t.TempDir(), "export.ndjson.gz")
+
+	out, err := run(t, "-dir", dir, "export", "-gzip", file)
+	assert.Nil(t, err)
+	assert.Equal(t, "Exported 3 events for 2 aggregates\n", out)
+
+	//Import into a store served over HTTP
+	store := inmemes.NewInMemoryEventStore()
+	server := httptest.NewServer(httpstore.NewServer(store))
+	defer server.Close()
+
+	out, err = run(t, "-url", server.URL, "import", "-dry-run", file)
+	assert.Nil(t, err)
+	assert.Equal(t, "Validated 3 events for 2 aggregates\n", out)
+	head, _ := store.HeadPosition()
+	assert.Equal(t, int64(0), head)
+
+	out, err = run(t, "-url", server.URL, "import", file)
+	assert.Nil(t, err)
+	assert.Equal(t, "Imported 3 events for 2 aggregates\n", out)
+
+	user, err := sample.NewUserRepository(store.WithCodec(sample.Codecs)).Load(first.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, "updated", user.FirstName)
+	assert.Equal(t, 2, user.Version)
+}
+
+func TestImportDryRunLeavesFileStoreAlone(t *testing.T) {
+	dir, _, _ := newFileStore(t)
+	file := filepath.Join(t.TempDir(), "export.ndjson")
+	_, err := run(t, "-dir", dir, "export", file)
+	assert.Nil(t, err)
+
+	//A dry run opens the store read only, so does not create it
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err = run(t, "-dir", missing, "import", "-dry-run", file)
+	assert.NotNil(t, err)
+	_, err = os.Stat(missing)
+	assert.True(t, os.IsNotExist(err))
+
+	out, err := run(t, "-dir", missing, "import", file)
+	assert.Nil(t, err)
+	assert.Equal(t, "Imported 3 events for 2 aggregates\n", out)
+}
+
+func TestTailAndRepublish(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs)
+	first, second := storeUsers(t, store)
+	server := httptest.NewServer(httpstore.NewServer(store).WithCodec(sample.Codecs))
+	defer server.Close()
+
+	out, err := run(t, "-url", server.URL, "tail", "-from", "2", "-count", "2")
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], first.AggregateID)
+		assert.Contains(t, lines[1], second.AggregateID)
+	}
+
+	out, err = run(t, "-url", server.URL, "republish")
+	assert.Nil(t, err)
+	assert.Equal(t, "Republished all events\n", out)
+
+	//A file store has no subscribers outside the process that has it open
+	dir, _, _ := newFileStore(t)
+	_, err = run(t, "-dir", dir, "republish")
+	assert.NotNil(t, err)
+}
+
+func TestTailStopsWhenServerGoesAway(t *testing.T) {
+	server := httptest.NewServer(httpstore.NewServer(inmemes.NewInMemoryEventStore()))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	_, err := run(t, "-url", server.URL, "tail")
+	assert.NotNil(t, err)
+}
+
+func TestTailFileStore(t *testing.T) {
+	dir, first, second := newFileStore(t)
+	writer, err := filestore.NewFileEventStore(dir)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer writer.Close()
+
+	type result struct {
+		out string
+		err error
+	}
+	tailed := make(chan result)
+	go func() {
+		out, err := run(t, "-dir", dir, "tail", "-from", "2", "-count", "3")
+		tailed <- result{out, err}
+	}()
+
+	//The event stored by another process while tail is running is shown
+	third, err := sample.NewUser("third", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, third.Store(writer.WithCodec(sample.Codecs)))
+
+	r := <-tailed
+	assert.Nil(t, r.err)
+	lines := strings.Split(strings.TrimSpace(r.out), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Contains(t, lines[0], first.AggregateID)
+		assert.Contains(t, lines[1], second.AggregateID)
+		assert.Contains(t, lines[2], third.AggregateID)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"aggregates"},
+		{"-dir", "a", "-url", "b", "aggregates"},
+		{"-dir", t.TempDir(), "unknown"},
+		{"-dir", t.TempDir(), "dump"},
+	} {
+		_, err := run(t, args...)
+		assert.Equal(t, cli.ErrUsage, err, "%v", args)
+	}
+}
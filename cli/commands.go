@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/archive"
+)
+
+//formatJSON returns the value as compact JSON.
+func formatJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+//formatRaw returns serialized payload bytes as they are if they are JSON, or base64
+//encoded otherwise.
+func formatRaw(data []byte) string {
+	if json.Valid(data) {
+		return string(data)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(data)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+//aggregateSummary describes an aggregate found in the global log.
+type aggregateSummary struct {
+	id      string
+	version int
+	events  int
+	last    time.Time
+}
+
+//summarize returns the aggregates in the global log, in the order they were created.
+func (t *tool) summarize() ([]*aggregateSummary, error) {
+	var summaries []*aggregateSummary
+	byID := make(map[string]*aggregateSummary)
+	err := t.eachEvent(1, func(e goes.Event) error {
+		s, ok := byID[e.Source]
+		if !ok {
+			s = &aggregateSummary{id: e.Source}
+			byID[e.Source] = s
+			summaries = append(summaries, s)
+		}
+		s.version = e.Version
+		s.events++
+		s.last = e.Timestamp
+		return nil
+	})
+	return summaries, err
+}
+
+func runAggregates(ctx context.Context, t *tool, args []string) error {
+	if err := t.parse(t.flags("aggregates"), args, 0); err != nil {
+		return err
+	}
+
+	summaries, err := t.summarize()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(t.config.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "AGGREGATE\tVERSION\tEVENTS\tLAST UPDATED")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", s.id, s.version, s.events, formatTime(s.last))
+	}
+	return w.Flush()
+}
+
+func runDump(ctx context.Context, t *tool, args []string) error {
+	fs := t.flags("dump")
+	from := fs.Int("from", 0, "first version to show")
+	to := fs.Int("to", 0, "last version to show; the latest if not set")
+	if err := t.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	events, err := goes.RetrieveEventRange(t.store, fs.Arg(0), goes.RangeQuery{FromVersion: *from, ToVersion: *to})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(t.config.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tPOSITION\tTYPE\tTIMESTAMP\tEVENT ID\tPAYLOAD")
+	for _, e := range events {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\n",
+			e.Version, e.Position, e.TypeCode, formatTime(e.Timestamp), e.EventID, t.payload(e))
+	}
+	return w.Flush()
+}
+
+//printEvent writes a line describing an event from the global log.
+func (t *tool) printEvent(e goes.Event) {
+	fmt.Fprintf(t.config.Stdout, "%d %s %s v%d %s %s\n",
+		e.Position, formatTime(e.Timestamp), e.Source, e.Version, e.TypeCode, t.payload(e))
+}
+
+func runTail(ctx context.Context, t *tool, args []string) error {
+	fs := t.flags("tail")
+	from := fs.Int64("from", 0, "log position to start from; only new events are shown if not set")
+	count := fs.Int("count", 0, "number of events to show before stopping; runs until interrupted if not set")
+	if err := t.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	//Without a starting position, follow on from the events already stored
+	if *from < 1 {
+		head, err := t.store.HeadPosition()
+		if err != nil {
+			return err
+		}
+		*from = head + 1
+	}
+
+	if !t.remote {
+		return t.pollLog(ctx, *from, *count)
+	}
+
+	catchUp, ok := t.store.(goes.CatchUpSubscriber)
+	if !ok {
+		return fmt.Errorf("Store does not support subscriptions")
+	}
+
+	events := make(chan goes.Event, logPageSize)
+	done := make(chan struct{})
+	defer close(done)
+
+	id, err := catchUp.SubscribeFrom(*from, func(e goes.Event) {
+		select {
+		case events <- e:
+		case <-done:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer t.store.(goes.EventPublisher).Unsubscribe(id)
+
+	//Stop if the subscription fails, rather than waiting for events that will not come
+	var ended <-chan struct{}
+	ender, ok := t.store.(subscriptionEnder)
+	if ok {
+		ended = ender.Done(id)
+	}
+
+	for shown := 0; *count == 0 || shown < *count; shown++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ended:
+			if err := ender.Err(); err != nil {
+				return err
+			}
+			return errors.New("Subscription ended")
+		case e := <-events:
+			t.printEvent(e)
+		}
+	}
+	return nil
+}
+
+//subscriptionEnder is implemented by the clients of a store served by goes-server,
+//whose subscriptions end if the connection to the server is lost.
+type subscriptionEnder interface {
+	Done(subscriptionID goes.SubscriptionID) <-chan struct{}
+	Err() error
+}
+
+//refresher is implemented by a file backed store opened read only, which finds the
+//events written by another process when refreshed.
+type refresher interface {
+	Refresh() error
+}
+
+//pollLog shows the events in the global log from the given position, checking for new
+//events every pollInterval, until count events have been shown or ctx is done.
+func (t *tool) pollLog(ctx context.Context, from int64, count int) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var shown int
+	for {
+		if r, ok := t.store.(refresher); ok {
+			if err := r.Refresh(); err != nil {
+				return err
+			}
+		}
+
+		page, err := t.store.ReadEventLog(from, logPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range page {
+			t.printEvent(e)
+			if shown++; count > 0 && shown >= count {
+				return nil
+			}
+		}
+
+		if len(page) > 0 {
+			from = page[len(page)-1].Position + 1
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func runStats(ctx context.Context, t *tool, args []string) error {
+	if err := t.parse(t.flags("stats"), args, 0); err != nil {
+		return err
+	}
+
+	head, err := t.store.HeadPosition()
+	if err != nil {
+		return err
+	}
+
+	var events int
+	var first, last time.Time
+	aggregates := make(map[string]bool)
+	types := make(map[string]int)
+	err = t.eachEvent(1, func(e goes.Event) error {
+		if events == 0 {
+			first = e.Timestamp
+		}
+		events++
+		last = e.Timestamp
+		aggregates[e.Source] = true
+		types[e.TypeCode]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(t.config.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Head position:\t%d\n", head)
+	fmt.Fprintf(w, "Aggregates:\t%d\n", len(aggregates))
+	fmt.Fprintf(w, "Events:\t%d\n", events)
+	fmt.Fprintf(w, "First event:\t%s\n", formatTime(first))
+	fmt.Fprintf(w, "Last event:\t%s\n", formatTime(last))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	typeCodes := make([]string, 0, len(types))
+	for typeCode := range types {
+		typeCodes = append(typeCodes, typeCode)
+	}
+	sort.Strings(typeCodes)
+
+	fmt.Fprintln(t.config.Stdout)
+	w = tabwriter.NewWriter(t.config.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tEVENTS")
+	for _, typeCode := range typeCodes {
+		fmt.Fprintf(w, "%s\t%d\n", typeCode, types[typeCode])
+	}
+	return w.Flush()
+}
+
+func runExport(ctx context.Context, t *tool, args []string) error {
+	fs := t.flags("export")
+	compress := fs.Bool("gzip", false, "compress the archive")
+	if err := t.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	file, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	manifest, err := archive.Export(file, t.store, archive.ExportConfig{Gzip: *compress})
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(t.config.Stdout, "Exported %d events for %d aggregates\n", manifest.Events, manifest.Aggregates)
+	return nil
+}
+
+//importWrites reports whether import will store events, which it does unless the
+//arguments ask for a dry run.
+func importWrites(args []string) bool {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "")
+	return fs.Parse(args) != nil || !*dryRun
+}
+
+func runImport(ctx context.Context, t *tool, args []string) error {
+	fs := t.flags("import")
+	dryRun := fs.Bool("dry-run", false, "validate the archive against the store without importing it")
+	if err := t.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	manifest, err := archive.Import(file, t.store, archive.ImportConfig{DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Validated"
+	}
+	fmt.Fprintf(t.config.Stdout, "%s %d events for %d aggregates\n", verb, manifest.Events, manifest.Aggregates)
+	return nil
+}
+
+func runRepublish(ctx context.Context, t *tool, args []string) error {
+	if err := t.parse(t.flags("republish"), args, 0); err != nil {
+		return err
+	}
+	if err := t.requireRemote("republish"); err != nil {
+		return err
+	}
+
+	republisher, ok := t.store.(goes.EventRepublisher)
+	if !ok {
+		return fmt.Errorf("Store does not support republishing")
+	}
+	if err := republisher.RepublishAllEvents(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(t.config.Stdout, "Republished all events")
+	return nil
+}
@@ -0,0 +1,104 @@
+//Command goes-server serves an event store over HTTP using the httpstore API, and
+//optionally over gRPC using the grpcstore service when -grpc-addr is set.
+//
+//Events are held in memory unless a directory is given with -dir, in which case they
+//are stored in a file backed store in that directory. Payloads are stored as they are
+//sent by clients, already serialized by the client's codec.
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/grpcstore"
+	"github.com/xtracdev/goes/httpstore"
+	"github.com/xtracdev/goes/inmems"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve the gRPC service on; not served if not set")
+	dir := flag.String("dir", "", "directory of a file backed store; events are held in memory if not set")
+	flag.Parse()
+
+	var store interface {
+		goes.EventStore
+		io.Closer
+	}
+	if *dir == "" {
+		store = inmemes.NewInMemoryEventStore()
+	} else {
+		fs, err := filestore.NewFileEventStore(*dir)
+		if err != nil {
+			log.Fatalf("Opening store in %s: %v", *dir, err)
+		}
+		store = fs
+	}
+
+	//Requests are cancelled on shutdown, which ends open subscriptions
+	base, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        *addr,
+		Handler:     httpstore.NewServer(store),
+		BaseContext: func(net.Listener) context.Context { return base },
+	}
+
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("Listening on %s: %v", *grpcAddr, err)
+		}
+
+		grpcServer = grpc.NewServer()
+		grpcstore.RegisterEventStoreServer(grpcServer, grpcstore.NewServer(store))
+		go func() {
+			log.Printf("Serving gRPC event store on %s", *grpcAddr)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("Serving gRPC: %v", err)
+			}
+		}()
+	}
+
+	//Shut down cleanly on interrupt, so the store is closed once in flight requests
+	//have finished
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		cancelRequests()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Shutting down: %v", err)
+		}
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+	}()
+
+	log.Printf("Serving event store on %s", *addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+
+	if err := store.Close(); err != nil {
+		log.Fatalf("Closing store: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+//Command goes inspects and administers event stores. Run it without arguments for
+//usage.
+//
+//This build decodes the sample User events; services build their own copy with a
+//codec for their event types, calling cli.Run in the same way.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/xtracdev/goes/cli"
+	"github.com/xtracdev/goes/sample"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := cli.Run(ctx, os.Args[1:], cli.Config{
+		Codec:  sample.Codecs,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	if errors.Is(err, cli.ErrUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
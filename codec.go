@@ -0,0 +1,222 @@
+package goes
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//Codec marshals event payloads to bytes for storage and unmarshals them again. The
+//values passed to both methods are pointers to the payload type.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+//JSONCodec is a Codec using encoding/json.
+type JSONCodec struct{}
+
+//Marshal returns the JSON encoding of v.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+//Unmarshal decodes the JSON encoded data into v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+//GobCodec is a Codec using encoding/gob.
+type GobCodec struct{}
+
+//Marshal returns the gob encoding of v.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//Unmarshal decodes the gob encoded data into v.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+//EventCodec converts events between the form used by aggregates, with typed payloads,
+//and the form persisted by event stores, with []byte payloads identified by TypeCode.
+type EventCodec interface {
+	EncodeEvent(Event) (Event, error)
+	DecodeEvent(Event) (Event, error)
+}
+
+type registration struct {
+	typeCode      string
+	schemaVersion int
+	payloadType   reflect.Type
+	codec         Codec
+}
+
+//TypeRegistry is an EventCodec that maps event type codes to payload types and the
+//codec used to serialize them. Payload types are registered once, typically in an
+//init function, after which any aggregate using them can be persisted without
+//writing its own serialization.
+type TypeRegistry struct {
+	sync.RWMutex
+	byCode map[string]registration
+	byType map[reflect.Type]registration
+}
+
+//NewTypeRegistry creates an empty TypeRegistry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		byCode: make(map[string]registration),
+		byType: make(map[reflect.Type]registration),
+	}
+}
+
+//Register associates the type code with the type of the prototype payload, which
+//is serialized using codec. Payloads of the type and of pointers to the type are
+//encoded; they are decoded to the type of the prototype.
+func (r *TypeRegistry) Register(typeCode string, prototype interface{}, codec Codec) error {
+	return r.RegisterVersion(typeCode, 0, prototype, codec)
+}
+
+//RegisterVersion is like Register, but also records the current schema version of the
+//payload type. Encoded events are stamped with the schema version, allowing events
+//written with older versions of the schema to be upcast when they are read.
+func (r *TypeRegistry) RegisterVersion(typeCode string, schemaVersion int, prototype interface{}, codec Codec) error {
+	payloadType := reflect.TypeOf(prototype)
+	if payloadType == nil {
+		return fmt.Errorf("No payload type given for type code %s", typeCode)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.byCode[typeCode]; ok {
+		return fmt.Errorf("Type code %s is already registered", typeCode)
+	}
+	if existing, ok := r.byType[baseType(payloadType)]; ok {
+		return fmt.Errorf("Payload type %v is already registered as %s", payloadType, existing.typeCode)
+	}
+
+	reg := registration{
+		typeCode:      typeCode,
+		schemaVersion: schemaVersion,
+		payloadType:   payloadType,
+		codec:         codec,
+	}
+	r.byCode[typeCode] = reg
+	r.byType[baseType(payloadType)] = reg
+
+	return nil
+}
+
+//MustRegister is like Register but panics if the registration fails. It simplifies
+//registering payload types from init functions.
+func (r *TypeRegistry) MustRegister(typeCode string, prototype interface{}, codec Codec) {
+	if err := r.Register(typeCode, prototype, codec); err != nil {
+		panic(err)
+	}
+}
+
+//EncodeEvent serializes the payload of the event and sets its type code and schema
+//version. Events whose payload is already a []byte are returned unchanged.
+func (r *TypeRegistry) EncodeEvent(event Event) (Event, error) {
+	if _, ok := event.Payload.([]byte); ok {
+		return event, nil
+	}
+
+	payloadType := reflect.TypeOf(event.Payload)
+	if payloadType == nil {
+		return event, fmt.Errorf("%w: nil payload", ErrUnknownEventType)
+	}
+
+	r.RLock()
+	reg, ok := r.byType[baseType(payloadType)]
+	r.RUnlock()
+	if !ok {
+		return event, fmt.Errorf("%w: %v", ErrUnknownEventType, payloadType)
+	}
+
+	//Codecs are always given a pointer, as some (protobuf for example) require one
+	ptr := reflect.ValueOf(event.Payload)
+	if payloadType.Kind() != reflect.Ptr {
+		ptr = reflect.New(payloadType)
+		ptr.Elem().Set(reflect.ValueOf(event.Payload))
+	}
+
+	data, err := reg.codec.Marshal(ptr.Interface())
+	if err != nil {
+		return event, err
+	}
+
+	event.TypeCode = reg.typeCode
+	event.SchemaVersion = reg.schemaVersion
+	event.Payload = data
+
+	return event, nil
+}
+
+//DecodeEvent deserializes the []byte payload of the event into the type registered
+//for its type code. Events whose payload is not a []byte are returned unchanged; an
+//unregistered type code returns an error wrapping ErrUnknownEventType.
+func (r *TypeRegistry) DecodeEvent(event Event) (Event, error) {
+	data, ok := event.Payload.([]byte)
+	if !ok {
+		return event, nil
+	}
+
+	r.RLock()
+	reg, ok := r.byCode[event.TypeCode]
+	r.RUnlock()
+	if !ok {
+		return event, fmt.Errorf("%w: type code %q", ErrUnknownEventType, event.TypeCode)
+	}
+
+	ptr := reflect.New(baseType(reg.payloadType))
+	if err := reg.codec.Unmarshal(data, ptr.Interface()); err != nil {
+		return event, err
+	}
+
+	if reg.payloadType.Kind() == reflect.Ptr {
+		event.Payload = ptr.Interface()
+	} else {
+		event.Payload = ptr.Elem().Interface()
+	}
+
+	return event, nil
+}
+
+//EncodeEvents encodes each of the events with the codec.
+func EncodeEvents(codec EventCodec, events []Event) ([]Event, error) {
+	return convertEvents(codec.EncodeEvent, events)
+}
+
+//DecodeEvents decodes each of the events with the codec.
+func DecodeEvents(codec EventCodec, events []Event) ([]Event, error) {
+	return convertEvents(codec.DecodeEvent, events)
+}
+
+func convertEvents(convert func(Event) (Event, error), events []Event) ([]Event, error) {
+	converted := make([]Event, 0, len(events))
+	for _, e := range events {
+		c, err := convert(e)
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, c)
+	}
+	return converted, nil
+}
+
+func baseType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,65 @@
+package goes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Greeted struct {
+	Name string
+}
+
+type Waved struct {
+	Hand string
+}
+
+func TestTypeRegistryRoundTrip(t *testing.T) {
+	registry := NewTypeRegistry()
+	assert.Nil(t, registry.Register("GREETED", Greeted{}, JSONCodec{}))
+	assert.Nil(t, registry.Register("WAVED", &Waved{}, GobCodec{}))
+
+	events := []Event{
+		{Source: "agg", Version: 1, TypeCode: "GREETED", Payload: Greeted{Name: "joe"}},
+		{Source: "agg", Version: 2, TypeCode: "WAVED", Payload: &Waved{Hand: "left"}},
+	}
+
+	encoded, err := EncodeEvents(registry, events)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(encoded)) {
+		assert.Equal(t, "GREETED", encoded[0].TypeCode)
+		assert.IsType(t, []byte{}, encoded[0].Payload)
+		assert.Equal(t, "WAVED", encoded[1].TypeCode)
+		assert.Equal(t, 2, encoded[1].Version)
+	}
+
+	decoded, err := DecodeEvents(registry, encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, events, decoded)
+}
+
+func TestTypeRegistryUnknownTypes(t *testing.T) {
+	registry := NewTypeRegistry()
+	registry.MustRegister("GREETED", Greeted{}, JSONCodec{})
+
+	_, err := registry.EncodeEvent(Event{Payload: Waved{}})
+	assert.True(t, errors.Is(err, ErrUnknownEventType))
+
+	_, err = registry.DecodeEvent(Event{TypeCode: "WAVED", Payload: []byte("{}")})
+	assert.True(t, errors.Is(err, ErrUnknownEventType))
+
+	//Payloads that are not serialized are passed through
+	e, err := registry.DecodeEvent(Event{Payload: Greeted{Name: "sally"}})
+	assert.Nil(t, err)
+	assert.Equal(t, Greeted{Name: "sally"}, e.Payload)
+}
+
+func TestTypeRegistryDuplicates(t *testing.T) {
+	registry := NewTypeRegistry()
+	registry.MustRegister("GREETED", Greeted{}, JSONCodec{})
+
+	assert.NotNil(t, registry.Register("GREETED", Waved{}, JSONCodec{}))
+	assert.NotNil(t, registry.Register("HELLO", &Greeted{}, JSONCodec{}))
+	assert.NotNil(t, registry.Register("NIL", nil, JSONCodec{}))
+}
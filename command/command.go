@@ -0,0 +1,88 @@
+//Package command dispatches commands to their handlers through a chain of middleware.
+//
+//A Bus holds a handler for each command type, typically one loading an aggregate from a
+//goes.Repository and running the command against it with Update. Middleware wraps the
+//handlers to validate, log, retry or deduplicate commands in one place, rather than in
+//each aggregate's command methods.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	//ErrNoHandler is returned when dispatching a command with no registered handler.
+	ErrNoHandler = errors.New("No handler registered for command")
+	//ErrInvalidCommand is wrapped by the errors returned for commands that fail
+	//validation.
+	ErrInvalidCommand = errors.New("Invalid command")
+)
+
+//Command is a request to change the state of an aggregate. Commands are dispatched to
+//their handlers according to their type.
+type Command interface {
+	//CommandName names the command in logs and errors.
+	CommandName() string
+}
+
+//Handler handles a command.
+type Handler func(cmd Command) error
+
+//Middleware wraps a handler with behaviour common to all commands.
+type Middleware func(next Handler) Handler
+
+//Bus dispatches commands to the handlers registered for their types, through the
+//middleware in the order it was added.
+type Bus struct {
+	sync.RWMutex
+	handlers   map[reflect.Type]Handler
+	middleware []Middleware
+}
+
+//NewBus creates a bus with no handlers or middleware.
+func NewBus() *Bus {
+	return &Bus{
+		handlers: make(map[reflect.Type]Handler),
+	}
+}
+
+//Use adds middleware to the bus. The first middleware added is the outermost, seeing
+//each command first.
+func (b *Bus) Use(middleware ...Middleware) *Bus {
+	b.Lock()
+	defer b.Unlock()
+	b.middleware = append(b.middleware, middleware...)
+	return b
+}
+
+//Handle registers handler for commands of type C, replacing any handler already
+//registered for the type.
+func Handle[C Command](b *Bus, handler func(C) error) {
+	b.Lock()
+	defer b.Unlock()
+	b.handlers[reflect.TypeOf((*C)(nil)).Elem()] = func(cmd Command) error {
+		return handler(cmd.(C))
+	}
+}
+
+//Dispatch passes the command through the middleware to the handler registered for its
+//type.
+func (b *Bus) Dispatch(cmd Command) error {
+	b.RLock()
+	handler, ok := b.handlers[reflect.TypeOf(cmd)]
+	middleware := b.middleware
+	b.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNoHandler, cmd)
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler(cmd)
+}
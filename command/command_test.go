@@ -0,0 +1,128 @@
+package command_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/command"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+)
+
+func newUserBus(t *testing.T) (*command.Bus, goes.EventStore, *sample.User, *bytes.Buffer) {
+	store := inmemes.NewInMemoryEventStore()
+	user, err := sample.NewUser("joe", "bloggs", "joe@example.com")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+
+	var logged bytes.Buffer
+	bus := command.NewBus().Use(
+		command.Logging(log.New(&logged, "", 0)),
+		command.Validation(),
+		command.Idempotency(command.NewInMemoryIdempotencyStore()),
+		command.Retry(2),
+	)
+	sample.RegisterUserCommands(bus, sample.NewUserRepository(store))
+
+	return bus, store, user, &logged
+}
+
+func TestDispatchToRepository(t *testing.T) {
+	bus, store, user, logged := newUserBus(t)
+
+	err := bus.Dispatch(sample.UpdateFirstNameCommand{UserID: user.AggregateID, FirstName: "joseph", RequestID: "r1"})
+	assert.Nil(t, err)
+
+	restored, err := sample.NewUserRepository(store).Load(user.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, "joseph", restored.FirstName)
+	assert.True(t, strings.Contains(logged.String(), "command UpdateFirstName handled"))
+}
+
+func TestRetriedCommandIsHandledOnce(t *testing.T) {
+	bus, store, user, _ := newUserBus(t)
+
+	cmd := sample.UpdateFirstNameCommand{UserID: user.AggregateID, FirstName: "joseph", RequestID: "r1"}
+	assert.Nil(t, bus.Dispatch(cmd))
+	assert.Nil(t, bus.Dispatch(cmd))
+
+	events, err := store.RetrieveEvents(user.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(events))
+}
+
+func TestInvalidCommandIsRejected(t *testing.T) {
+	bus, _, _, logged := newUserBus(t)
+
+	err := bus.Dispatch(sample.UpdateFirstNameCommand{FirstName: "joseph"})
+	assert.True(t, errors.Is(err, command.ErrInvalidCommand))
+	assert.True(t, strings.Contains(logged.String(), "command UpdateFirstName failed"))
+}
+
+type unhandled struct{}
+
+func (unhandled) CommandName() string { return "Unhandled" }
+
+func TestNoHandler(t *testing.T) {
+	err := command.NewBus().Dispatch(unhandled{})
+	assert.True(t, errors.Is(err, command.ErrNoHandler))
+}
+
+type flaky struct {
+	Key string
+}
+
+func (flaky) CommandName() string { return "Flaky" }
+
+func (f flaky) IdempotencyKey() string { return f.Key }
+
+func TestRetryAndRelease(t *testing.T) {
+	var attempts int
+	failures := []error{&goes.ConcurrencyError{}, &goes.ConcurrencyError{}, errors.New("failed"), nil}
+
+	bus := command.NewBus().Use(command.Idempotency(command.NewInMemoryIdempotencyStore()), command.Retry(2))
+	command.Handle(bus, func(flaky) error {
+		err := failures[attempts]
+		attempts++
+		return err
+	})
+
+	//Concurrency errors are retried, other errors are not
+	assert.NotNil(t, bus.Dispatch(flaky{Key: "k"}))
+	assert.Equal(t, 3, attempts)
+
+	//A failed command does not use up its idempotency key
+	assert.Nil(t, bus.Dispatch(flaky{Key: "k"}))
+	assert.Nil(t, bus.Dispatch(flaky{Key: "k"}))
+	assert.Equal(t, 4, attempts)
+}
+
+//uncompletable is an idempotency store that fails to complete keys.
+type uncompletable struct {
+	*command.InMemoryIdempotencyStore
+}
+
+func (uncompletable) Complete(string) error {
+	return errors.New("store unavailable")
+}
+
+func TestHandledCommandNotFailedByIdempotencyStore(t *testing.T) {
+	var attempts int
+	bus := command.NewBus().Use(command.Idempotency(uncompletable{command.NewInMemoryIdempotencyStore()}))
+	command.Handle(bus, func(flaky) error {
+		attempts++
+		return nil
+	})
+
+	assert.Nil(t, bus.Dispatch(flaky{Key: "k"}))
+	assert.Equal(t, 1, attempts)
+
+	//The key was left in progress, so the command is not handled again
+	assert.Equal(t, command.ErrCommandInProgress, bus.Dispatch(flaky{Key: "k"}))
+	assert.Equal(t, 1, attempts)
+}
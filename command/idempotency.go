@@ -0,0 +1,126 @@
+package command
+
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+//ErrCommandInProgress is returned when a command is dispatched while another command
+//with the same idempotency key is being handled.
+var ErrCommandInProgress = errors.New("Command with the same idempotency key in progress")
+
+//IdempotentCommand is implemented by commands carrying an idempotency key, such as a
+//client supplied request id. Commands with the same key are handled at most once.
+type IdempotentCommand interface {
+	IdempotencyKey() string
+}
+
+//KeyStatus is the status of an idempotency key.
+type KeyStatus int
+
+const (
+	//KeyNew means no command with the key has been handled.
+	KeyNew KeyStatus = iota
+	//KeyInProgress means a command with the key is being handled.
+	KeyInProgress
+	//KeyCompleted means a command with the key has been handled successfully.
+	KeyCompleted
+)
+
+//IdempotencyStore records the idempotency keys of the commands handled.
+type IdempotencyStore interface {
+	//Reserve returns the status of the key, marking it in progress if it is new.
+	Reserve(key string) (KeyStatus, error)
+	//Complete marks the key as handled successfully.
+	Complete(key string) error
+	//Release discards the reservation of a key whose command failed, so the command
+	//can be retried.
+	Release(key string) error
+}
+
+//Idempotency returns middleware that handles commands implementing IdempotentCommand at
+//most once per key. A command whose key has already been handled successfully is
+//acknowledged without being handled again, so it does not emit duplicate events.
+//
+//The idempotency store is not updated atomically with the events the command stores.
+//If the key cannot be marked completed once the command has been handled, the command
+//is still reported as handled and the failure is logged; the key stays in progress, so
+//commands with the same key are rejected with ErrCommandInProgress until the key is
+//completed or released in the store.
+func Idempotency(store IdempotencyStore) Middleware {
+	return func(next Handler) Handler {
+		return func(cmd Command) error {
+			idempotent, ok := cmd.(IdempotentCommand)
+			if !ok || idempotent.IdempotencyKey() == "" {
+				return next(cmd)
+			}
+
+			key := cmd.CommandName() + "/" + idempotent.IdempotencyKey()
+			status, err := store.Reserve(key)
+			if err != nil {
+				return err
+			}
+
+			switch status {
+			case KeyCompleted:
+				return nil
+			case KeyInProgress:
+				return ErrCommandInProgress
+			}
+
+			if err := next(cmd); err != nil {
+				store.Release(key)
+				return err
+			}
+
+			if err := store.Complete(key); err != nil {
+				log.Printf("command %s handled but idempotency key %s not completed: %v", cmd.CommandName(), key, err)
+			}
+			return nil
+		}
+	}
+}
+
+//InMemoryIdempotencyStore implements the IdempotencyStore interface, holding the keys
+//in memory.
+type InMemoryIdempotencyStore struct {
+	sync.Mutex
+	keys map[string]KeyStatus
+}
+
+//NewInMemoryIdempotencyStore is a factory method for creating InMemoryIdempotencyStore
+//instances.
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{
+		keys: make(map[string]KeyStatus),
+	}
+}
+
+//Reserve returns the status of the key, marking it in progress if it is new.
+func (s *InMemoryIdempotencyStore) Reserve(key string) (KeyStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	status := s.keys[key]
+	if status == KeyNew {
+		s.keys[key] = KeyInProgress
+	}
+	return status, nil
+}
+
+//Complete marks the key as handled successfully.
+func (s *InMemoryIdempotencyStore) Complete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.keys[key] = KeyCompleted
+	return nil
+}
+
+//Release discards the reservation of the key.
+func (s *InMemoryIdempotencyStore) Release(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.keys, key)
+	return nil
+}
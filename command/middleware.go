@@ -0,0 +1,62 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+//Validator is implemented by commands that can check they are well formed before they
+//are handled.
+type Validator interface {
+	Validate() error
+}
+
+//Validation returns middleware that rejects commands implementing Validator that fail
+//validation, with an error wrapping ErrInvalidCommand.
+func Validation() Middleware {
+	return func(next Handler) Handler {
+		return func(cmd Command) error {
+			if validator, ok := cmd.(Validator); ok {
+				if err := validator.Validate(); err != nil {
+					return fmt.Errorf("%w: %s: %v", ErrInvalidCommand, cmd.CommandName(), err)
+				}
+			}
+			return next(cmd)
+		}
+	}
+}
+
+//Logging returns middleware that logs each command handled, how long it took and
+//whether it failed.
+func Logging(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(cmd Command) error {
+			start := time.Now()
+			err := next(cmd)
+			if err != nil {
+				logger.Printf("command %s failed after %v: %v", cmd.CommandName(), time.Since(start), err)
+			} else {
+				logger.Printf("command %s handled in %v", cmd.CommandName(), time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+//Retry returns middleware that handles a command again, up to retries more times, if
+//it fails with an optimistic concurrency error.
+func Retry(retries int) Middleware {
+	return func(next Handler) Handler {
+		return func(cmd Command) error {
+			err := next(cmd)
+			for attempt := 0; attempt < retries && errors.Is(err, goes.ErrConcurrency); attempt++ {
+				err = next(cmd)
+			}
+			return err
+		}
+	}
+}
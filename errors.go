@@ -0,0 +1,62 @@
+package goes
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	//ErrAggregateNotFound is returned when no events are stored for an aggregate.
+	ErrAggregateNotFound = errors.New("No events stored for aggregate")
+
+	//ErrConcurrency is matched by errors.Is for every ConcurrencyError, for callers
+	//that only need to know a write lost an optimistic concurrency race.
+	ErrConcurrency = errors.New("Concurrency exception")
+
+	//ErrEventSequence is returned when the versions of the events being stored are not
+	//sequential, or do not follow on from the version already stored.
+	ErrEventSequence = errors.New("Event versions are not sequential")
+
+	//ErrUnknownEventType is returned when an event's type code or payload type is
+	//not known to the aggregate or codec handling it.
+	ErrUnknownEventType = errors.New("Unknown event type")
+
+	//ErrDuplicateAggregate is returned when the same aggregate appears more than once
+	//in a batch of aggregates stored together.
+	ErrDuplicateAggregate = errors.New("Aggregate repeated in batch")
+
+	//ErrBatchNotSupported is returned when committing a unit of work to an event store
+	//that cannot store several aggregates atomically.
+	ErrBatchNotSupported = errors.New("Event store does not support batches")
+
+	//ErrVersionNotFound is returned when loading an aggregate as of a version it has not
+	//reached.
+	ErrVersionNotFound = errors.New("Aggregate version not found")
+
+	//ErrMissingTimestamp is returned when loading an aggregate as of a point in time
+	//and one of its stored events has no timestamp.
+	ErrMissingTimestamp = errors.New("Stored event has no timestamp")
+
+	//ErrNotCloneable is returned when listing the history of an aggregate that the
+	//repository has no way to copy.
+	ErrNotCloneable = errors.New("Aggregate cannot be copied")
+)
+
+//ConcurrencyError is returned when events cannot be stored because the aggregate was
+//updated by someone else first. ExpectedVersion is the version the writer expected the
+//stored aggregate to be at, and ActualVersion is the version it is actually at.
+type ConcurrencyError struct {
+	AggregateID     string
+	ExpectedVersion int
+	ActualVersion   int
+}
+
+func (e *ConcurrencyError) Error() string {
+	return fmt.Sprintf("Concurrency exception: aggregate %s expected at version %d, actual version %d",
+		e.AggregateID, e.ExpectedVersion, e.ActualVersion)
+}
+
+//Is makes errors.Is(err, ErrConcurrency) true for any ConcurrencyError.
+func (e *ConcurrencyError) Is(target error) bool {
+	return target == ErrConcurrency
+}
@@ -0,0 +1,24 @@
+package goes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyError(t *testing.T) {
+	var err error = &ConcurrencyError{AggregateID: "agg", ExpectedVersion: 2, ActualVersion: 3}
+	wrapped := fmt.Errorf("store failed: %w", err)
+
+	assert.True(t, errors.Is(wrapped, ErrConcurrency))
+	assert.False(t, errors.Is(wrapped, ErrAggregateNotFound))
+
+	var concurrencyErr *ConcurrencyError
+	if assert.True(t, errors.As(wrapped, &concurrencyErr)) {
+		assert.Equal(t, "agg", concurrencyErr.AggregateID)
+		assert.Equal(t, 2, concurrencyErr.ExpectedVersion)
+		assert.Equal(t, 3, concurrencyErr.ActualVersion)
+	}
+}
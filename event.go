@@ -1,5 +1,7 @@
 package goes
 
+import "time"
+
 //Event defines a structure that carries information related to an event, including the
 //source aggregate of the event, the aggregate version the event is associated with, the payload,
 //and the typecode indicating the type of the event.
@@ -7,9 +9,83 @@ package goes
 //Note that events for an aggregate can be ordered by version; version is incremented for each event
 //associated with an aggregate. Event storage will also typically include a timestamp column for
 //the absolute ordering of events in terms of their storage date.
+//
+//Stores that keep a global log assign each stored event a Position, which increases
+//monotonically across all aggregates in the order the events were committed. Position is
+//zero for events that have not been stored.
+//
+//SchemaVersion identifies the version of the payload schema an event was serialized with,
+//so events written with an older schema can be upcast to the current one when read.
+//
+//In addition to the domain data, each event carries a metadata envelope: a unique
+//event ID, the time the event was recorded, correlation and causation IDs for
+//tracing the request and the prior event that produced it, and free form string
+//headers.
 type Event struct {
-	Source   string
-	Version  int
-	Payload  interface{}
-	TypeCode string
+	Source        string
+	Version       int
+	Payload       interface{}
+	TypeCode      string
+	SchemaVersion int
+	Position      int64
+	EventID       string
+	Timestamp     time.Time
+	CorrelationID string
+	CausationID   string
+	Headers       map[string]string
+}
+
+//InitMetadata assigns an event ID and timestamp to the event if they have not
+//already been set. If no correlation ID has been supplied the event ID is used,
+//making the event the start of a new correlated chain.
+func (e *Event) InitMetadata() error {
+	if e.EventID == "" {
+		id, err := GenerateID()
+		if err != nil {
+			return err
+		}
+		e.EventID = id
+	}
+
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	if e.CorrelationID == "" {
+		e.CorrelationID = e.EventID
+	}
+
+	return nil
+}
+
+//CausedBy records cause as the event that led to this event being produced. The
+//correlation ID of the cause is carried forward so the whole chain of events can
+//be traced back to the originating request.
+func (e *Event) CausedBy(cause Event) {
+	e.CausationID = cause.EventID
+	e.CorrelationID = cause.CorrelationID
+	if e.CorrelationID == "" {
+		e.CorrelationID = cause.EventID
+	}
+}
+
+//SetHeader sets a free form header value on the event.
+func (e *Event) SetHeader(key, value string) {
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+	e.Headers[key] = value
+}
+
+//Copy returns a copy of the event that shares no header storage with the
+//original, so stores can retain events without aliasing the caller's maps.
+func (e Event) Copy() Event {
+	if e.Headers != nil {
+		headers := make(map[string]string, len(e.Headers))
+		for k, v := range e.Headers {
+			headers[k] = v
+		}
+		e.Headers = headers
+	}
+	return e
 }
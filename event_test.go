@@ -0,0 +1,45 @@
+package goes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitMetadata(t *testing.T) {
+	var e Event
+	err := e.InitMetadata()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, e.EventID)
+	assert.False(t, e.Timestamp.IsZero())
+	assert.Equal(t, e.EventID, e.CorrelationID)
+
+	//Existing values are left alone
+	id, ts := e.EventID, e.Timestamp
+	e.InitMetadata()
+	assert.Equal(t, id, e.EventID)
+	assert.Equal(t, ts, e.Timestamp)
+}
+
+func TestCausedBy(t *testing.T) {
+	var cause Event
+	cause.InitMetadata()
+
+	var effect Event
+	effect.CausedBy(cause)
+	effect.InitMetadata()
+
+	assert.Equal(t, cause.EventID, effect.CausationID)
+	assert.Equal(t, cause.CorrelationID, effect.CorrelationID)
+	assert.NotEqual(t, cause.EventID, effect.EventID)
+}
+
+func TestCopyHeaders(t *testing.T) {
+	var e Event
+	e.SetHeader("user", "joe")
+
+	c := e.Copy()
+	c.SetHeader("user", "sally")
+	assert.Equal(t, "joe", e.Headers["user"])
+	assert.Equal(t, "sally", c.Headers["user"])
+}
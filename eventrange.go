@@ -0,0 +1,66 @@
+package goes
+
+//RangeQuery selects a range of an aggregate's events by version. Events with versions
+//from FromVersion to ToVersion inclusive are selected; a ToVersion less than 1 selects
+//up to the latest version. Backward returns the selected events newest first, and
+//MaxEvents, when greater than zero, limits the number of events returned, counting
+//from the start of the read direction.
+//
+//To page forward through a stream, set FromVersion to one more than the last version
+//read; to page backward, set ToVersion to one less than the last version read.
+type RangeQuery struct {
+	FromVersion int
+	ToVersion   int
+	Backward    bool
+	MaxEvents   int
+}
+
+//Includes returns true if the version falls within the range of the query.
+func (q RangeQuery) Includes(version int) bool {
+	return version >= q.FromVersion && (q.ToVersion < 1 || version <= q.ToVersion)
+}
+
+//Filter applies the query to a slice of events ordered by version, returning the
+//selected events in the requested order.
+func (q RangeQuery) Filter(events []Event) []Event {
+	var selected []Event
+	for i := range events {
+		e := events[i]
+		if q.Backward {
+			e = events[len(events)-1-i]
+		}
+
+		if !q.Includes(e.Version) {
+			continue
+		}
+
+		selected = append(selected, e)
+		if q.MaxEvents > 0 && len(selected) == q.MaxEvents {
+			break
+		}
+	}
+
+	return selected
+}
+
+//EventRangeReader defines the methods offered by an event store that can read a
+//range of an aggregate's events without retrieving the whole stream.
+type EventRangeReader interface {
+	RetrieveEventRange(aggID string, query RangeQuery) ([]Event, error)
+}
+
+//RetrieveEventRange reads the range of the aggregate's events selected by the query.
+//If the store implements EventRangeReader the range is read directly, otherwise all
+//the aggregate's events are retrieved and filtered.
+func RetrieveEventRange(store EventStore, aggID string, query RangeQuery) ([]Event, error) {
+	if reader, ok := store.(EventRangeReader); ok {
+		return reader.RetrieveEventRange(aggID, query)
+	}
+
+	events, err := store.RetrieveEvents(aggID)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Filter(events), nil
+}
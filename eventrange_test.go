@@ -0,0 +1,56 @@
+package goes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//basicStore implements only the EventStore interface.
+type basicStore struct {
+	events []Event
+}
+
+func (bs *basicStore) StoreEvents(agg *Aggregate) error {
+	bs.events = append(bs.events, agg.Events...)
+	return nil
+}
+
+func (bs *basicStore) RetrieveEvents(aggID string) ([]Event, error) {
+	return bs.events, nil
+}
+
+func versions(events []Event) []int {
+	var v []int
+	for _, e := range events {
+		v = append(v, e.Version)
+	}
+	return v
+}
+
+func TestRetrieveEventRange(t *testing.T) {
+	store := new(basicStore)
+	for i := 1; i <= 10; i++ {
+		store.events = append(store.events, Event{Version: i})
+	}
+
+	events, err := RetrieveEventRange(store, "agg", RangeQuery{FromVersion: 3, ToVersion: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3, 4, 5}, versions(events))
+
+	events, err = RetrieveEventRange(store, "agg", RangeQuery{FromVersion: 8})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{8, 9, 10}, versions(events))
+
+	events, err = RetrieveEventRange(store, "agg", RangeQuery{Backward: true, MaxEvents: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{10, 9, 8}, versions(events))
+
+	events, err = RetrieveEventRange(store, "agg", RangeQuery{ToVersion: 7, Backward: true, MaxEvents: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{7, 6}, versions(events))
+
+	events, err = RetrieveEventRange(store, "agg", RangeQuery{FromVersion: 4, MaxEvents: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{4, 5}, versions(events))
+}
@@ -19,16 +19,49 @@ type EventPublisher interface {
 	Unsubscribe(sub SubscriptionID)
 }
 
+//CatchUpSubscriber defines the methods offered by an event publisher that can replay
+//stored history to a single new subscriber before switching it to live events. The
+//callback receives every event from fromPosition onwards in log order, with no gaps or
+//duplicates between the replayed history and the live events that follow.
+type CatchUpSubscriber interface {
+	SubscribeFrom(fromPosition int64, callback EventPublishedCallback) (SubscriptionID, error)
+}
+
 //EventRepublisher defines the methods an event store capable of republishing
 //events must implement.
 type EventRepublisher interface {
 	RepublishAllEvents() error
 }
 
+//EventLogReader defines the methods offered by an event store that keeps a global
+//log of all stored events in commit order. Positions start at 1; ReadEventLog returns
+//up to maxEvents events with a position greater than or equal to fromPosition, so a
+//reader resumes from a checkpoint by passing the last position it processed plus one.
+//A maxEvents value less than 1 returns all remaining events. HeadPosition returns the
+//position of the most recently stored event, or zero if the log is empty.
+type EventLogReader interface {
+	ReadEventLog(fromPosition int64, maxEvents int) ([]Event, error)
+	HeadPosition() (int64, error)
+}
+
 //EventSourced specifies the methods an event sourced domain object must
 //implement.
 type EventSourced interface {
-	Store(EventStore)
-	Apply(Event)
-	Route(Event)
+	Store(EventStore) error
+	Apply(Event) error
+	Route(Event) error
+}
+
+//EventSourcedAggregate is implemented by event sourced domain objects that embed
+//a pointer to the Aggregate type.
+type EventSourcedAggregate interface {
+	EventSourced
+	AggregateRoot() *Aggregate
+}
+
+//Snapshotter is implemented by event sourced domain objects that can capture their
+//state in a snapshot and restore it again.
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+	RestoreSnapshot(Snapshot) error
 }
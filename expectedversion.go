@@ -0,0 +1,88 @@
+package goes
+
+import "fmt"
+
+//ExpectedVersion states the version an aggregate's stored events must be at for a
+//write to succeed. Values of zero or more require the stored aggregate to be at
+//exactly that version, with zero meaning no events have been stored.
+type ExpectedVersion int
+
+const (
+	//ExpectAny appends the events regardless of the stored version of the aggregate.
+	ExpectAny ExpectedVersion = -2
+	//ExpectNoStream requires that no events have been stored for the aggregate.
+	ExpectNoStream ExpectedVersion = -1
+)
+
+//ExpectVersion returns an ExpectedVersion requiring the stored aggregate to be at
+//exactly the given version.
+func ExpectVersion(version int) ExpectedVersion {
+	return ExpectedVersion(version)
+}
+
+//ExpectedVersionStore defines the methods offered by an event store that accepts an
+//explicit expected version when storing events. Stores implementing it must validate
+//that the incoming event versions follow on from the stored version with no gaps.
+//
+//With ExpectAny the events are appended after whatever is stored: their versions are
+//renumbered to follow the stored events, and agg.Version is updated to match.
+type ExpectedVersionStore interface {
+	StoreEventsExpecting(agg *Aggregate, expected ExpectedVersion) error
+}
+
+//Check returns a ConcurrencyError if an aggregate stored at currentVersion does not
+//satisfy the expected version.
+func (ev ExpectedVersion) Check(aggregateID string, currentVersion int) error {
+	switch {
+	case ev == ExpectAny:
+		return nil
+	case ev == ExpectNoStream && currentVersion == 0:
+		return nil
+	case ev == ExpectNoStream:
+		return &ConcurrencyError{AggregateID: aggregateID, ExpectedVersion: 0, ActualVersion: currentVersion}
+	case int(ev) != currentVersion:
+		return &ConcurrencyError{AggregateID: aggregateID, ExpectedVersion: int(ev), ActualVersion: currentVersion}
+	}
+
+	return nil
+}
+
+//ValidateEventSequence checks the aggregate's events have sequential versions starting
+//at firstVersion, and that the aggregate version is the version of the last event, or
+//firstVersion - 1 if there are no events. The error returned wraps ErrEventSequence.
+func ValidateEventSequence(agg *Aggregate, firstVersion int) error {
+	for i, e := range agg.Events {
+		if e.Version != firstVersion+i {
+			return fmt.Errorf("%w: aggregate %s event %d has version %d, expected %d",
+				ErrEventSequence, agg.AggregateID, i, e.Version, firstVersion+i)
+		}
+	}
+
+	if agg.Version != firstVersion+len(agg.Events)-1 {
+		return fmt.Errorf("%w: aggregate %s is at version %d, expected %d",
+			ErrEventSequence, agg.AggregateID, agg.Version, firstVersion+len(agg.Events)-1)
+	}
+
+	return nil
+}
+
+//Renumber returns a copy of the aggregate with its events renumbered to follow on from
+//an aggregate stored at currentVersion, as stores do when storing with ExpectAny. The
+//events must already have sequential versions. The aggregate given is left unchanged,
+//so a store can update it only once the events have been stored.
+func Renumber(agg *Aggregate, currentVersion int) (*Aggregate, error) {
+	if err := ValidateEventSequence(agg, agg.Version-len(agg.Events)+1); err != nil {
+		return nil, err
+	}
+
+	renumbered := &Aggregate{
+		AggregateID: agg.AggregateID,
+		Events:      make([]Event, len(agg.Events)),
+		Version:     currentVersion + len(agg.Events),
+	}
+	for i, e := range agg.Events {
+		e.Version = currentVersion + i + 1
+		renumbered.Events[i] = e
+	}
+	return renumbered, nil
+}
@@ -0,0 +1,64 @@
+package goes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectedVersionCheck(t *testing.T) {
+	assert.Nil(t, ExpectAny.Check("agg", 0))
+	assert.Nil(t, ExpectAny.Check("agg", 5))
+
+	assert.Nil(t, ExpectNoStream.Check("agg", 0))
+	assert.True(t, errors.Is(ExpectNoStream.Check("agg", 1), ErrConcurrency))
+
+	assert.Nil(t, ExpectVersion(3).Check("agg", 3))
+	err := ExpectVersion(3).Check("agg", 4)
+	var concurrencyErr *ConcurrencyError
+	if assert.True(t, errors.As(err, &concurrencyErr)) {
+		assert.Equal(t, 3, concurrencyErr.ExpectedVersion)
+		assert.Equal(t, 4, concurrencyErr.ActualVersion)
+	}
+}
+
+func TestValidateEventSequence(t *testing.T) {
+	agg := &Aggregate{
+		AggregateID: "agg",
+		Version:     4,
+		Events:      []Event{{Version: 3}, {Version: 4}},
+	}
+	assert.Nil(t, ValidateEventSequence(agg, 3))
+	assert.True(t, errors.Is(ValidateEventSequence(agg, 2), ErrEventSequence))
+
+	agg.Events[1].Version = 5
+	assert.True(t, errors.Is(ValidateEventSequence(agg, 3), ErrEventSequence))
+
+	agg.Events[1].Version = 4
+	agg.Version = 7
+	assert.True(t, errors.Is(ValidateEventSequence(agg, 3), ErrEventSequence))
+
+	assert.Nil(t, ValidateEventSequence(&Aggregate{Version: 7}, 8))
+	assert.True(t, errors.Is(ValidateEventSequence(&Aggregate{Version: 9}, 8), ErrEventSequence))
+}
+
+func TestRenumber(t *testing.T) {
+	agg := &Aggregate{
+		AggregateID: "agg",
+		Version:     2,
+		Events:      []Event{{Version: 1}, {Version: 2}},
+	}
+	renumbered, err := Renumber(agg, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, renumbered.Version)
+	assert.Equal(t, []Event{{Version: 6}, {Version: 7}}, renumbered.Events)
+
+	//The aggregate given is unchanged
+	assert.Equal(t, 2, agg.Version)
+	assert.Equal(t, 1, agg.Events[0].Version)
+
+	agg.Version = 3
+	_, err = Renumber(agg, 5)
+	assert.True(t, errors.Is(err, ErrEventSequence))
+}
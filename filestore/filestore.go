@@ -0,0 +1,706 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//DefaultSegmentSize is the size at which a segment is rotated when no size is
+//configured.
+const DefaultSegmentSize = 64 << 20
+
+//republishPageSize is the number of events read from the log at a time when
+//republishing.
+const republishPageSize = 256
+
+var (
+	//ErrStoreClosed is returned when using a store that has been closed.
+	ErrStoreClosed = errors.New("Event store closed")
+	//ErrCorruptLog is returned when the log contains a record that cannot be read
+	//and is not the result of an interrupted write.
+	ErrCorruptLog = errors.New("Corrupt event log")
+	//ErrPayloadNotSerialized is returned when storing an event whose payload is not a
+	//byte slice once encoded with the store's codec.
+	ErrPayloadNotSerialized = errors.New("Event payload not serialized")
+	//ErrReadOnly is returned when storing events in a store opened read only.
+	ErrReadOnly = errors.New("Event store opened read only")
+)
+
+//Config configures a FileEventStore.
+type Config struct {
+	//SegmentSize is the size in bytes at which the current segment is closed and a
+	//new one started. A single write larger than this gets a segment of its own.
+	SegmentSize int64
+	//ReadOnly opens the store for reading a directory that another store may be
+	//writing to. Writes return ErrReadOnly, an incomplete record at the end of the log
+	//is left for the writer to finish instead of being truncated, and Refresh picks up
+	//the events written since the store was opened.
+	ReadOnly bool
+}
+
+//location identifies where an event is held in the log: the segment, the offset of
+//the record within the segment, and the index of the event within the record.
+type location struct {
+	segment int
+	offset  int64
+	item    int
+}
+
+//aggregateIndex holds the log positions of the events for a single aggregate, in
+//version order.
+type aggregateIndex struct {
+	positions      []int64
+	currentVersion int
+}
+
+//FileEventStore implements the EventStore, ExpectedVersionStore, BatchStore,
+//EventRangeReader, EventPublisher, EventRepublisher and EventLogReader interfaces on top
+//of an append only log held in a directory of segment files.
+//
+//Each write is appended to the log as a single checksummed record and flushed to disk
+//before it returns, so the events of a write are stored atomically. The index of the
+//log is held in memory and rebuilt when the store is opened; a record left incomplete
+//by a crash part way through a write is discarded at that point.
+//
+//Event payloads are stored as byte slices, so events must either carry serialized
+//payloads or the store must be given a codec. Only one FileEventStore may write to a
+//directory at a time, though any number may read it with Config.ReadOnly.
+type FileEventStore struct {
+	sync.RWMutex
+	dir        string
+	config     Config
+	codec      goes.EventCodec
+	upcasters  *goes.UpcasterChain
+	segments   []*segment
+	log        []location
+	aggregates map[string]aggregateIndex
+	publisher  *publisher
+	closed     bool
+}
+
+//NewFileEventStore opens the event store held in dir, creating it if it does not exist.
+func NewFileEventStore(dir string) (*FileEventStore, error) {
+	return NewFileEventStoreWithConfig(dir, Config{})
+}
+
+//NewFileEventStoreWithConfig opens the event store held in dir using the given
+//configuration, creating it if it does not exist. A SegmentSize of zero or less uses
+//DefaultSegmentSize.
+func NewFileEventStoreWithConfig(dir string, config Config) (*FileEventStore, error) {
+	if config.SegmentSize < 1 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+
+	if config.ReadOnly {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	fs := &FileEventStore{
+		dir:        dir,
+		config:     config,
+		aggregates: make(map[string]aggregateIndex),
+	}
+
+	if err := fs.load(); err != nil {
+		fs.closeSegments()
+		return nil, err
+	}
+
+	fs.publisher = newPublisher()
+
+	return fs, nil
+}
+
+//load opens the segment files and rebuilds the index of the log.
+func (fs *FileEventStore) load() error {
+	names, err := filepath.Glob(filepath.Join(fs.dir, "*"+segmentSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(name), segmentSuffix))
+		if err != nil {
+			return fmt.Errorf("Unexpected segment file %s", name)
+		}
+
+		seg, err := openSegment(name, id, fs.config.ReadOnly)
+		if err != nil {
+			return err
+		}
+		fs.segments = append(fs.segments, seg)
+
+		if err := fs.indexSegment(len(fs.segments)-1, 0, i == len(names)-1); err != nil {
+			return err
+		}
+	}
+
+	if len(fs.segments) == 0 && !fs.config.ReadOnly {
+		seg, err := createSegment(fs.dir, 1)
+		if err != nil {
+			return err
+		}
+		fs.segments = append(fs.segments, seg)
+	}
+
+	return nil
+}
+
+//indexSegment adds the records in a segment from offset onwards to the index. An
+//incomplete record at the end of the last segment was left by an interrupted write and
+//is truncated, or in a read only store is left unindexed as it may still be being
+//written; any other unreadable record is reported as corruption.
+func (fs *FileEventStore) indexSegment(segIdx int, offset int64, last bool) error {
+	seg := fs.segments[segIdx]
+
+	for offset < seg.size {
+		events, length, err := seg.readRecord(offset)
+
+		//A write interrupted by a crash leaves a record that runs past the end of
+		//the segment, or a final record that does not match its checksum
+		torn := err == errTornRecord || (err == errChecksum && offset+length == seg.size)
+		if last && torn && fs.config.ReadOnly {
+			seg.size = offset
+			return nil
+		}
+		if last && torn {
+			return seg.truncate(offset)
+		}
+		if err != nil {
+			return fmt.Errorf("Reading %s at offset %d: %w", seg.file.Name(), offset, err)
+		}
+
+		if err := fs.indexRecord(segIdx, offset, events); err != nil {
+			return fmt.Errorf("Reading %s at offset %d: %w", seg.file.Name(), offset, err)
+		}
+		offset += length
+	}
+
+	return nil
+}
+
+//indexRecord adds the events held in a record to the index, checking they follow on
+//from the events already indexed.
+func (fs *FileEventStore) indexRecord(segIdx int, offset int64, events []goes.Event) error {
+	for i, e := range events {
+		if e.Position != int64(len(fs.log)+1) {
+			return fmt.Errorf("%w: event at position %d found at position %d", ErrCorruptLog, e.Position, len(fs.log)+1)
+		}
+
+		aggIndex := fs.aggregates[e.Source]
+		if e.Version != aggIndex.currentVersion+1 {
+			return fmt.Errorf("%w: event version %d for aggregate %s follows version %d",
+				ErrCorruptLog, e.Version, e.Source, aggIndex.currentVersion)
+		}
+
+		aggIndex.positions = append(aggIndex.positions, e.Position)
+		aggIndex.currentVersion = e.Version
+		fs.aggregates[e.Source] = aggIndex
+		fs.log = append(fs.log, location{segment: segIdx, offset: offset, item: i})
+	}
+
+	return nil
+}
+
+//WithCodec sets a codec used to encode event payloads when they are stored and decode
+//them when they are read or published. It should be set before the store is used.
+func (fs *FileEventStore) WithCodec(codec goes.EventCodec) *FileEventStore {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.codec = codec
+	return fs
+}
+
+//WithUpcasters sets the upcaster chain applied to stored events when they are read
+//or republished, before they are decoded. It should be set before the store is used.
+func (fs *FileEventStore) WithUpcasters(upcasters *goes.UpcasterChain) *FileEventStore {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.upcasters = upcasters
+	return fs
+}
+
+//readEvent returns a stored event as it is read by clients: upcast to the current
+//schema and decoded, if the store has upcasters and a codec.
+func (fs *FileEventStore) readEvent(e goes.Event) ([]goes.Event, error) {
+	events := []goes.Event{e}
+	if fs.upcasters != nil {
+		var err error
+		if events, err = fs.upcasters.Upcast(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if fs.codec == nil {
+		return events, nil
+	}
+	return goes.DecodeEvents(fs.codec, events)
+}
+
+//recordReader reads stored events by log position, reading a record once for a run
+//of events that were written together.
+type recordReader struct {
+	fs      *FileEventStore
+	current location
+	events  []goes.Event
+}
+
+func (r *recordReader) read(position int64) (goes.Event, error) {
+	loc := r.fs.log[position-1]
+	if r.events == nil || loc.segment != r.current.segment || loc.offset != r.current.offset {
+		events, _, err := r.fs.segments[loc.segment].readRecord(loc.offset)
+		if err != nil {
+			return goes.Event{}, err
+		}
+		r.current, r.events = loc, events
+	}
+
+	return r.events[loc.item].Copy(), nil
+}
+
+//StoreEvents stores the events for the given aggregate in the event store, then
+//publishes them to the subscribers. The events must follow on from the version already
+//stored; if the stored aggregate has moved on since the events were produced a
+//ConcurrencyError is returned.
+func (fs *FileEventStore) StoreEvents(agg *goes.Aggregate) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.checkWritableLocked(); err != nil {
+		return err
+	}
+
+	current := fs.aggregates[agg.AggregateID].currentVersion
+	if err := checkVersion(agg, current); err != nil {
+		return err
+	}
+
+	return fs.appendLocked(agg, current)
+}
+
+//checkWritableLocked returns an error if events cannot be stored in the store.
+func (fs *FileEventStore) checkWritableLocked() error {
+	if fs.closed {
+		return ErrStoreClosed
+	}
+	if fs.config.ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+//checkVersion returns a ConcurrencyError if the aggregate's events do not follow on from
+//the current stored version.
+func checkVersion(agg *goes.Aggregate, current int) error {
+	base := agg.Version - len(agg.Events)
+	if !(current < agg.Version) || base < current {
+		return &goes.ConcurrencyError{
+			AggregateID:     agg.AggregateID,
+			ExpectedVersion: base,
+			ActualVersion:   current,
+		}
+	}
+	return nil
+}
+
+//StoreBatch stores the events of all the aggregates as a single record, then publishes
+//them to the subscribers. The events of each aggregate must follow on from the version
+//already stored, as for StoreEvents.
+func (fs *FileEventStore) StoreBatch(aggs ...*goes.Aggregate) error {
+	if err := goes.CheckBatch(aggs); err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.checkWritableLocked(); err != nil {
+		return err
+	}
+
+	var stored []goes.Event
+	for _, agg := range aggs {
+		current := fs.aggregates[agg.AggregateID].currentVersion
+		if err := checkVersion(agg, current); err != nil {
+			return err
+		}
+
+		events, err := fs.prepareLocked(agg, current, len(stored))
+		if err != nil {
+			return err
+		}
+		stored = append(stored, events...)
+	}
+
+	return fs.writeLocked(stored)
+}
+
+//StoreEventsExpecting stores the events for the given aggregate if the stored aggregate
+//satisfies the expected version, then publishes them to the subscribers.
+func (fs *FileEventStore) StoreEventsExpecting(agg *goes.Aggregate, expected goes.ExpectedVersion) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err := fs.checkWritableLocked(); err != nil {
+		return err
+	}
+
+	current := fs.aggregates[agg.AggregateID].currentVersion
+	if err := expected.Check(agg.AggregateID, current); err != nil {
+		return err
+	}
+
+	//Renumber the events to follow on from whatever is stored, updating the caller's
+	//aggregate only once they have been stored
+	if expected == goes.ExpectAny {
+		renumbered, err := goes.Renumber(agg, current)
+		if err != nil {
+			return err
+		}
+		if err := fs.appendLocked(renumbered, current); err != nil {
+			return err
+		}
+
+		for i := range agg.Events {
+			agg.Events[i].Version = renumbered.Events[i].Version
+		}
+		agg.Version = renumbered.Version
+		return nil
+	}
+
+	return fs.appendLocked(agg, current)
+}
+
+//appendLocked writes the aggregate's events to the log, following on from the aggregate
+//stored at the current version.
+func (fs *FileEventStore) appendLocked(agg *goes.Aggregate, current int) error {
+	stored, err := fs.prepareLocked(agg, current, 0)
+	if err != nil {
+		return err
+	}
+
+	return fs.writeLocked(stored)
+}
+
+//prepareLocked validates the aggregate's events against the current stored version, and
+//returns them in the form they are stored. The events are positioned in the global log
+//after offset other events about to be written.
+func (fs *FileEventStore) prepareLocked(agg *goes.Aggregate, current int, offset int) ([]goes.Event, error) {
+	if err := goes.ValidateEventSequence(agg, current+1); err != nil {
+		return nil, err
+	}
+
+	stored := make([]goes.Event, 0, len(agg.Events))
+	for i, e := range agg.Events {
+		event := e.Copy()
+		if err := event.InitMetadata(); err != nil {
+			return nil, err
+		}
+		if fs.codec != nil {
+			var err error
+			if event, err = fs.codec.EncodeEvent(event); err != nil {
+				return nil, err
+			}
+		}
+		event.Position = int64(len(fs.log) + offset + i + 1)
+		stored = append(stored, event)
+	}
+
+	return stored, nil
+}
+
+//writeLocked writes the prepared events to the log as a single record, then publishes
+//them.
+func (fs *FileEventStore) writeLocked(stored []goes.Event) error {
+	if len(stored) == 0 {
+		return nil
+	}
+
+	record, err := encodeRecord(stored)
+	if err != nil {
+		return err
+	}
+
+	seg, err := fs.segmentFor(int64(len(record)))
+	if err != nil {
+		return err
+	}
+
+	offset := seg.size
+	if err := seg.append(record); err != nil {
+		return err
+	}
+
+	if err := fs.indexRecord(len(fs.segments)-1, offset, stored); err != nil {
+		return err
+	}
+
+	fs.publishLocked(stored)
+
+	return nil
+}
+
+//segmentFor returns the segment a record of the given size is appended to, starting
+//a new segment if the current one is full.
+func (fs *FileEventStore) segmentFor(size int64) (*segment, error) {
+	last := fs.segments[len(fs.segments)-1]
+	if last.size == 0 || last.size+size <= fs.config.SegmentSize {
+		return last, nil
+	}
+
+	seg, err := createSegment(fs.dir, last.id+1)
+	if err != nil {
+		return nil, err
+	}
+	fs.segments = append(fs.segments, seg)
+
+	return seg, nil
+}
+
+//publishLocked queues the stored events for delivery to the subscribers. Events that
+//cannot be upcast or decoded are delivered in their stored form.
+func (fs *FileEventStore) publishLocked(events []goes.Event) {
+	decoded := make([]goes.Event, 0, len(events))
+	for _, e := range events {
+		read, err := fs.readEvent(e.Copy())
+		if err != nil {
+			read = []goes.Event{e}
+		}
+		decoded = append(decoded, read...)
+	}
+
+	fs.publisher.publish(decoded)
+}
+
+//RetrieveEvents retrieves the events in the event store associated with the given
+//aggregate id.
+func (fs *FileEventStore) RetrieveEvents(aggregateID string) ([]goes.Event, error) {
+	return fs.RetrieveEventRange(aggregateID, goes.RangeQuery{})
+}
+
+//RetrieveEventRange retrieves the range of events for the given aggregate id selected
+//by the query. The range is selected using the stored event versions; events split by
+//upcasting are returned whole, so the result may exceed MaxEvents.
+func (fs *FileEventStore) RetrieveEventRange(aggregateID string, query goes.RangeQuery) ([]goes.Event, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	if fs.closed {
+		return nil, ErrStoreClosed
+	}
+
+	aggIndex, ok := fs.aggregates[aggregateID]
+	if !ok {
+		return nil, goes.ErrAggregateNotFound
+	}
+
+	reader := recordReader{fs: fs}
+	positions := aggIndex.positions
+	var events []goes.Event
+	for i := range positions {
+		version := i + 1
+		if query.Backward {
+			version = len(positions) - i
+		}
+
+		if !query.Includes(version) {
+			continue
+		}
+
+		stored, err := reader.read(positions[version-1])
+		if err != nil {
+			return nil, err
+		}
+
+		read, err := fs.readEvent(stored)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, read...)
+		if query.MaxEvents > 0 && len(events) >= query.MaxEvents {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+//ReadEventLog reads up to maxEvents events from the global log, starting at
+//fromPosition. Events dropped by upcasting are skipped over, so an empty result always
+//means the end of the log has been reached.
+func (fs *FileEventStore) ReadEventLog(fromPosition int64, maxEvents int) ([]goes.Event, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	if fs.closed {
+		return nil, ErrStoreClosed
+	}
+
+	if fromPosition < 1 {
+		fromPosition = 1
+	}
+
+	reader := recordReader{fs: fs}
+	var events []goes.Event
+	for position := fromPosition; position <= int64(len(fs.log)); position++ {
+		if maxEvents > 0 && len(events) >= maxEvents {
+			break
+		}
+
+		stored, err := reader.read(position)
+		if err != nil {
+			return nil, err
+		}
+
+		read, err := fs.readEvent(stored)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, read...)
+	}
+
+	return events, nil
+}
+
+//Refresh adds the events written to the log by another store since a read only store
+//was opened, or last refreshed, to its index. The events are not published to the
+//store's subscribers. Refresh does nothing for a store that is not read only, which
+//already holds every event written to its log.
+func (fs *FileEventStore) Refresh() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if fs.closed {
+		return ErrStoreClosed
+	}
+	if !fs.config.ReadOnly {
+		return nil
+	}
+
+	names, err := filepath.Glob(filepath.Join(fs.dir, "*"+segmentSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	//Pick up the rest of the segment being written when the index was last built,
+	//then any segments started since
+	if len(fs.segments) > 0 {
+		segIdx := len(fs.segments) - 1
+		seg := fs.segments[segIdx]
+		info, err := seg.file.Stat()
+		if err != nil {
+			return err
+		}
+
+		offset := seg.size
+		seg.size = info.Size()
+		if err := fs.indexSegment(segIdx, offset, len(names) == len(fs.segments)); err != nil {
+			return err
+		}
+	}
+
+	for i := len(fs.segments); i < len(names); i++ {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(names[i]), segmentSuffix))
+		if err != nil {
+			return fmt.Errorf("Unexpected segment file %s", names[i])
+		}
+
+		seg, err := openSegment(names[i], id, true)
+		if err != nil {
+			return err
+		}
+		fs.segments = append(fs.segments, seg)
+
+		if err := fs.indexSegment(len(fs.segments)-1, 0, i == len(names)-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//HeadPosition returns the position of the last event written to the global log.
+func (fs *FileEventStore) HeadPosition() (int64, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+	return int64(len(fs.log)), nil
+}
+
+//SubscribeEvents registers the provided callback as an event subscriber. Events are
+//delivered to the subscribers from a single goroutine, in the order they were stored.
+func (fs *FileEventStore) SubscribeEvents(callback goes.EventPublishedCallback) goes.SubscriptionID {
+	return fs.publisher.subscribe(callback)
+}
+
+//Unsubscribe removes the event subscription associated with the provided subscription id.
+func (fs *FileEventStore) Unsubscribe(subscriptionID goes.SubscriptionID) {
+	fs.publisher.unsubscribe(subscriptionID)
+}
+
+//RepublishAllEvents republishes events to subscribers in the order they were
+//committed to the store. The log is published a page at a time, so events stored
+//while republishing is in progress may be interleaved with the republished events.
+func (fs *FileEventStore) RepublishAllEvents() error {
+	var position int64 = 1
+	for {
+		page, err := fs.ReadEventLog(position, republishPageSize)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		fs.publisher.publish(page)
+		position = page[len(page)-1].Position + 1
+	}
+}
+
+//Drain blocks until every event published so far has been delivered to the
+//subscribers. It must not be called from a subscriber callback.
+func (fs *FileEventStore) Drain() {
+	fs.publisher.drain()
+}
+
+//Close delivers any events still queued for the subscribers, then closes the segment
+//files. It must not be called from a subscriber callback.
+func (fs *FileEventStore) Close() error {
+	fs.Lock()
+	if fs.closed {
+		fs.Unlock()
+		return nil
+	}
+	fs.closed = true
+	fs.Unlock()
+
+	fs.publisher.close()
+
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.closeSegments()
+}
+
+func (fs *FileEventStore) closeSegments() error {
+	var firstErr error
+	for _, seg := range fs.segments {
+		if err := seg.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
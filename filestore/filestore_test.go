@@ -0,0 +1,243 @@
+package filestore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/sample"
+	"github.com/xtracdev/goes/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) goes.EventStore {
+		store, err := filestore.NewFileEventStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store.WithCodec(storetest.Codecs)
+	})
+}
+
+func openStore(t *testing.T, dir string, config filestore.Config) *filestore.FileEventStore {
+	store, err := filestore.NewFileEventStoreWithConfig(dir, config)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return store.WithCodec(sample.Codecs)
+}
+
+func storeUser(t *testing.T, store goes.EventStore, first string) *sample.User {
+	user, err := sample.NewUser(first, "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.UpdateFirstName(first+" updated"))
+	assert.Nil(t, user.Store(store))
+	return user
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	assert.Nil(t, err)
+	return names
+}
+
+func TestEventsSurviveReopening(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, filestore.Config{})
+	user := storeUser(t, store, "joe")
+	other := storeUser(t, store, "jane")
+	assert.Nil(t, store.Close())
+
+	store = openStore(t, dir, filestore.Config{})
+	defer store.Close()
+
+	events, err := store.RetrieveEvents(user.AggregateID)
+	assert.Nil(t, err)
+	restored := sample.NewUserFromHistory(events)
+	if assert.NotNil(t, restored) {
+		assert.Equal(t, "joe updated", restored.FirstName)
+		assert.Equal(t, 2, restored.Version)
+	}
+
+	head, err := store.HeadPosition()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), head)
+
+	log, err := store.ReadEventLog(3, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(log)) {
+		assert.Equal(t, other.AggregateID, log[0].Source)
+		assert.Equal(t, int64(3), log[0].Position)
+		assert.NotEmpty(t, log[0].EventID)
+	}
+
+	//Writes continue from the stored version
+	stale := sample.NewUserFromHistory(events[:1])
+	assert.Nil(t, stale.UpdateFirstName("stale"))
+	assert.True(t, errors.Is(stale.Store(store), goes.ErrConcurrency))
+}
+
+func TestSegmentsAreRotated(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, filestore.Config{SegmentSize: 1})
+	for _, name := range []string{"a", "b", "c"} {
+		storeUser(t, store, name)
+	}
+	assert.Nil(t, store.Close())
+	assert.Equal(t, 3, len(segmentFiles(t, dir)))
+
+	store = openStore(t, dir, filestore.Config{SegmentSize: 1})
+	defer store.Close()
+	log, err := store.ReadEventLog(1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(log))
+}
+
+func TestTornWriteIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, filestore.Config{})
+	storeUser(t, store, "joe")
+	assert.Nil(t, store.Close())
+
+	name := segmentFiles(t, dir)[0]
+	info, err := os.Stat(name)
+	assert.Nil(t, err)
+
+	//Simulate a crash part way through writing a record
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, '[', '{'})
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	store = openStore(t, dir, filestore.Config{})
+	defer store.Close()
+
+	truncated, err := os.Stat(name)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+
+	storeUser(t, store, "jane")
+	head, err := store.HeadPosition()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), head)
+}
+
+func TestCorruptRecordIsReported(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, filestore.Config{})
+	storeUser(t, store, "joe")
+	storeUser(t, store, "jane")
+	assert.Nil(t, store.Close())
+
+	//Damage the first record, which is followed by a good one
+	name := segmentFiles(t, dir)[0]
+	data, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	data[20] ^= 0xff
+	assert.Nil(t, os.WriteFile(name, data, 0644))
+
+	_, err = filestore.NewFileEventStore(dir)
+	assert.True(t, errors.Is(err, filestore.ErrCorruptLog))
+}
+
+func TestPayloadsMustBeSerialized(t *testing.T) {
+	store, err := filestore.NewFileEventStore(t.TempDir())
+	assert.Nil(t, err)
+	defer store.Close()
+
+	user, err := sample.NewUser("joe", "last", "email")
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(user.Store(store), filestore.ErrPayloadNotSerialized))
+}
+
+func TestFailedExpectAnyLeavesAggregate(t *testing.T) {
+	store, err := filestore.NewFileEventStore(t.TempDir())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer store.Close()
+	store = store.WithCodec(storetest.Codecs)
+
+	stored := &goes.Aggregate{AggregateID: "agg", Version: 1, Events: []goes.Event{
+		{Source: "agg", Version: 1, TypeCode: storetest.TestEventTypeCode, Payload: storetest.TestEvent{Name: "one"}},
+	}}
+	assert.Nil(t, store.StoreEvents(stored))
+
+	//The payload has no codec registered, so the events cannot be stored
+	agg := &goes.Aggregate{AggregateID: "agg", Version: 1, Events: []goes.Event{
+		{Source: "agg", Version: 1, TypeCode: "UNKNOWN", Payload: struct{ Name string }{"two"}},
+	}}
+	assert.NotNil(t, store.StoreEventsExpecting(agg, goes.ExpectAny))
+	assert.Equal(t, 1, agg.Version)
+	assert.Equal(t, 1, agg.Events[0].Version)
+}
+
+func TestEventsArePublished(t *testing.T) {
+	store := openStore(t, t.TempDir(), filestore.Config{})
+
+	var published []goes.Event
+	store.SubscribeEvents(func(e goes.Event) {
+		published = append(published, e)
+	})
+
+	storeUser(t, store, "joe")
+	store.Drain()
+	if assert.Equal(t, 2, len(published)) {
+		assert.IsType(t, sample.UserCreated{}, published[0].Payload)
+	}
+
+	assert.Nil(t, store.RepublishAllEvents())
+	assert.Nil(t, store.Close())
+	assert.Equal(t, 4, len(published))
+}
+
+func TestReadOnlyStoreFollowsWriter(t *testing.T) {
+	dir := t.TempDir()
+	writer := openStore(t, dir, filestore.Config{SegmentSize: 1})
+	defer writer.Close()
+	storeUser(t, writer, "joe")
+
+	reader := openStore(t, dir, filestore.Config{ReadOnly: true})
+	defer reader.Close()
+	user, err := sample.NewUser("jane", "last", "email")
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(user.Store(reader), filestore.ErrReadOnly))
+
+	head, err := reader.HeadPosition()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), head)
+	storeUser(t, writer, "jane")
+
+	//Events written since the reader opened the store, in a new segment, are found by
+	//refreshing; a record still being written is left alone
+	name := segmentFiles(t, dir)[len(segmentFiles(t, dir))-1]
+	info, err := os.Stat(name)
+	assert.Nil(t, err)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, '[', '{'})
+	assert.Nil(t, err)
+
+	assert.Nil(t, reader.Refresh())
+	log, err := reader.ReadEventLog(3, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(log)) {
+		assert.Equal(t, sample.UserFirstNameUpdatedTypeCode, log[1].TypeCode)
+	}
+
+	torn, err := os.Stat(name)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size()+10, torn.Size())
+	assert.Nil(t, f.Truncate(info.Size()))
+	assert.Nil(t, f.Close())
+}
+
+func TestReadOnlyStoreMustExist(t *testing.T) {
+	_, err := filestore.NewFileEventStoreWithConfig(filepath.Join(t.TempDir(), "missing"), filestore.Config{ReadOnly: true})
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,127 @@
+package filestore
+
+import (
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+type subscription struct {
+	id       goes.SubscriptionID
+	callback goes.EventPublishedCallback
+}
+
+//publisher delivers events to the subscribers from its own goroutine, in the order
+//they were published. Its queue is unbounded, so writers never wait on subscribers
+//and callbacks may read from and write to the store.
+type publisher struct {
+	mu            sync.Mutex
+	cond          *sync.Cond
+	subscriptions []subscription
+	queue         []goes.Event
+	busy          bool
+	closed        bool
+	done          chan struct{}
+}
+
+func newPublisher() *publisher {
+	p := &publisher{
+		done: make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	go p.run()
+
+	return p
+}
+
+func (p *publisher) subscribe(callback goes.EventPublishedCallback) goes.SubscriptionID {
+	id, _ := goes.GenerateID()
+	subscriptionID := goes.SubscriptionID(id)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.subscriptions = append(p.subscriptions, subscription{id: subscriptionID, callback: callback})
+	}
+
+	return subscriptionID
+}
+
+func (p *publisher) unsubscribe(id goes.SubscriptionID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	remaining := make([]subscription, 0, len(p.subscriptions))
+	for _, s := range p.subscriptions {
+		if s.id != id {
+			remaining = append(remaining, s)
+		}
+	}
+	p.subscriptions = remaining
+}
+
+//publish queues the events for delivery. Events are dropped if there are no
+//subscribers to deliver them to.
+func (p *publisher) publish(events []goes.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || len(p.subscriptions) == 0 {
+		return
+	}
+
+	p.queue = append(p.queue, events...)
+	p.cond.Broadcast()
+}
+
+func (p *publisher) run() {
+	defer close(p.done)
+
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+
+		event := p.queue[0]
+		p.queue = p.queue[1:]
+		subscriptions := p.subscriptions
+		p.busy = true
+		p.mu.Unlock()
+
+		for _, s := range subscriptions {
+			s.callback(event.Copy())
+		}
+
+		p.mu.Lock()
+		p.busy = false
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+//drain blocks until every queued event has been delivered.
+func (p *publisher) drain() {
+	p.mu.Lock()
+	for len(p.queue) > 0 || p.busy {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+}
+
+//close stops the publisher after the queued events have been delivered, and waits
+//for its goroutine to exit.
+func (p *publisher) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	<-p.done
+}
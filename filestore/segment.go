@@ -0,0 +1,230 @@
+package filestore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+//Segment files hold a sequence of records, each holding the events committed by
+//a single write:
+//
+//	length uint32 | checksum uint32 | body [length]byte
+//
+//The length and the CRC-32 (Castagnoli) checksum of the body are big endian, and
+//the body is the JSON encoding of the committed events. A record is never split
+//across segments.
+const headerSize = 8
+
+const segmentSuffix = ".seg"
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	//errTornRecord is returned for a record that runs past the end of its segment.
+	errTornRecord = fmt.Errorf("%w: incomplete record", ErrCorruptLog)
+	//errChecksum is returned for a record whose body does not match its checksum.
+	errChecksum = fmt.Errorf("%w: record checksum mismatch", ErrCorruptLog)
+)
+
+//storedEvent is the serialized form of an event in a record body.
+type storedEvent struct {
+	Source        string
+	Version       int
+	TypeCode      string
+	SchemaVersion int
+	Position      int64
+	EventID       string
+	Timestamp     time.Time
+	CorrelationID string
+	CausationID   string
+	Headers       map[string]string
+	Payload       []byte
+}
+
+//segment is an open segment file. Records are only appended to the last segment
+//in the log.
+type segment struct {
+	id   int
+	file *os.File
+	size int64
+}
+
+func segmentName(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+//createSegment creates a new, empty segment file in dir.
+func createSegment(dir string, id int) (*segment, error) {
+	file, err := os.OpenFile(segmentName(dir, id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncDir(dir); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &segment{id: id, file: file}, nil
+}
+
+//openSegment opens an existing segment file, for reading only if readOnly is set.
+func openSegment(name string, id int, readOnly bool) (*segment, error) {
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &segment{id: id, file: file, size: info.Size()}, nil
+}
+
+//syncDir flushes the directory entries in dir, so newly created segments survive
+//a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+//encodeRecord serializes the events as a single record. Each event payload must
+//already be serialized as a byte slice.
+func encodeRecord(events []goes.Event) ([]byte, error) {
+	stored := make([]storedEvent, len(events))
+	for i, e := range events {
+		payload, ok := e.Payload.([]byte)
+		if !ok && e.Payload != nil {
+			return nil, fmt.Errorf("%w: %T payload for event type %s", ErrPayloadNotSerialized, e.Payload, e.TypeCode)
+		}
+
+		stored[i] = storedEvent{
+			Source:        e.Source,
+			Version:       e.Version,
+			TypeCode:      e.TypeCode,
+			SchemaVersion: e.SchemaVersion,
+			Position:      e.Position,
+			EventID:       e.EventID,
+			Timestamp:     e.Timestamp,
+			CorrelationID: e.CorrelationID,
+			CausationID:   e.CausationID,
+			Headers:       e.Headers,
+			Payload:       payload,
+		}
+	}
+
+	body, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, headerSize+len(body))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(body, crcTable))
+	copy(record[headerSize:], body)
+
+	return record, nil
+}
+
+//readRecord reads the record at offset, returning the events it holds and the
+//length of the record. The length is also returned when the checksum does not match.
+func (s *segment) readRecord(offset int64) ([]goes.Event, int64, error) {
+	if offset+headerSize > s.size {
+		return nil, 0, errTornRecord
+	}
+
+	var header [headerSize]byte
+	if _, err := s.file.ReadAt(header[:], offset); err != nil {
+		return nil, 0, err
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length == 0 || offset+headerSize+length > s.size {
+		return nil, 0, errTornRecord
+	}
+
+	body := make([]byte, length)
+	if _, err := s.file.ReadAt(body, offset+headerSize); err != nil {
+		return nil, 0, err
+	}
+
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, headerSize + length, errChecksum
+	}
+
+	var stored []storedEvent
+	if err := json.Unmarshal(body, &stored); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrCorruptLog, err)
+	}
+
+	events := make([]goes.Event, len(stored))
+	for i, se := range stored {
+		events[i] = goes.Event{
+			Source:        se.Source,
+			Version:       se.Version,
+			TypeCode:      se.TypeCode,
+			SchemaVersion: se.SchemaVersion,
+			Position:      se.Position,
+			EventID:       se.EventID,
+			Timestamp:     se.Timestamp,
+			CorrelationID: se.CorrelationID,
+			CausationID:   se.CausationID,
+			Headers:       se.Headers,
+		}
+		if se.Payload != nil {
+			events[i].Payload = se.Payload
+		}
+	}
+
+	return events, headerSize + length, nil
+}
+
+//append writes the record to the end of the segment and flushes it to disk. If
+//the write fails the segment is truncated back to its previous size.
+func (s *segment) append(record []byte) error {
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	s.size += int64(len(record))
+	return nil
+}
+
+//truncate discards everything in the segment from offset onwards.
+func (s *segment) truncate(offset int64) error {
+	if err := s.file.Truncate(offset); err != nil {
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.size = offset
+	return nil
+}
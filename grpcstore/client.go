@@ -0,0 +1,263 @@
+package grpcstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/internal/subscription"
+	"google.golang.org/grpc"
+)
+
+//Client implements the EventStore, ExpectedVersionStore, EventRangeReader,
+//EventLogReader, EventPublisher and CatchUpSubscriber interfaces against the
+//EventStore service. Operations the store behind the server does not support return
+//ErrNotSupported.
+//
+//A subscription ends if its stream is lost or an event sent on it cannot be decoded;
+//the channel returned by Done is closed, and the error is reported by Err.
+type Client struct {
+	client        EventStoreClient
+	codec         goes.EventCodec
+	subscriptions *subscription.Remotes
+}
+
+//NewClient creates a client making calls on the connection.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{
+		client:        NewEventStoreClient(conn),
+		subscriptions: subscription.NewRemotes(),
+	}
+}
+
+//WithCodec sets a codec used to encode event payloads before they are sent to the
+//server, and decode them when they are read or published.
+func (c *Client) WithCodec(codec goes.EventCodec) *Client {
+	c.codec = codec
+	return c
+}
+
+//encode serializes the events to their protobuf form.
+func (c *Client) encode(events []goes.Event) ([]*Event, error) {
+	converted := make([]*Event, 0, len(events))
+	for _, e := range events {
+		if c.codec != nil {
+			var err error
+			if e, err = c.codec.EncodeEvent(e); err != nil {
+				return nil, err
+			}
+		}
+
+		pe, err := toProto(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %T payload for event type %s", err, e.Payload, e.TypeCode)
+		}
+		converted = append(converted, pe)
+	}
+	return converted, nil
+}
+
+//decode converts events from their protobuf form, decoding the payloads.
+func (c *Client) decode(events []*Event) ([]goes.Event, error) {
+	converted := make([]goes.Event, 0, len(events))
+	for _, pe := range events {
+		e := fromProto(pe)
+		if c.codec != nil {
+			var err error
+			if e, err = c.codec.DecodeEvent(e); err != nil {
+				return nil, err
+			}
+		}
+		converted = append(converted, e)
+	}
+	return converted, nil
+}
+
+func (c *Client) appendEvents(agg *goes.Aggregate, expected *int64) (int, error) {
+	events, err := c.encode(agg.Events)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.client.AppendToStream(context.Background(), &AppendToStreamRequest{
+		AggregateId:     agg.AggregateID,
+		Version:         int64(agg.Version),
+		ExpectedVersion: expected,
+		Events:          events,
+	})
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+	return int(resp.GetVersion()), nil
+}
+
+//StoreEvents stores the aggregate's events. The events must follow on from the version
+//already stored, otherwise a ConcurrencyError is returned.
+func (c *Client) StoreEvents(agg *goes.Aggregate) error {
+	_, err := c.appendEvents(agg, nil)
+	return err
+}
+
+//StoreEventsExpecting stores the aggregate's events if the stored aggregate satisfies
+//the expected version. With ExpectAny the events are renumbered to follow on from the
+//version stored, and agg.Version is updated to match.
+func (c *Client) StoreEventsExpecting(agg *goes.Aggregate, expected goes.ExpectedVersion) error {
+	ev := int64(expected)
+	version, err := c.appendEvents(agg, &ev)
+	if err != nil {
+		return err
+	}
+
+	if expected == goes.ExpectAny {
+		first := version - len(agg.Events) + 1
+		for i := range agg.Events {
+			agg.Events[i].Version = first + i
+		}
+		agg.Version = version
+	}
+	return nil
+}
+
+//RetrieveEvents retrieves the events stored for the aggregate.
+func (c *Client) RetrieveEvents(aggregateID string) ([]goes.Event, error) {
+	return c.RetrieveEventRange(aggregateID, goes.RangeQuery{})
+}
+
+//RetrieveEventRange retrieves the range of the aggregate's events selected by the
+//query.
+func (c *Client) RetrieveEventRange(aggregateID string, query goes.RangeQuery) ([]goes.Event, error) {
+	resp, err := c.client.ReadStream(context.Background(), &ReadStreamRequest{
+		AggregateId: aggregateID,
+		FromVersion: int64(query.FromVersion),
+		ToVersion:   int64(query.ToVersion),
+		Backward:    query.Backward,
+		MaxEvents:   int32(query.MaxEvents),
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return c.decode(resp.GetEvents())
+}
+
+//ReadEventLog reads up to maxEvents events from the global log, starting at
+//fromPosition.
+func (c *Client) ReadEventLog(fromPosition int64, maxEvents int) ([]goes.Event, error) {
+	resp, err := c.client.ReadAll(context.Background(), &ReadAllRequest{
+		FromPosition: fromPosition,
+		MaxEvents:    int32(maxEvents),
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return c.decode(resp.GetEvents())
+}
+
+//HeadPosition returns the position of the last event written to the global log.
+func (c *Client) HeadPosition() (int64, error) {
+	resp, err := c.client.ReadAll(context.Background(), &ReadAllRequest{MaxEvents: 1})
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+	return resp.GetHeadPosition(), nil
+}
+
+//SubscribeEvents registers the callback as a subscriber to the events stored from now
+//on. If the subscription cannot be made the error is reported by Err.
+func (c *Client) SubscribeEvents(callback goes.EventPublishedCallback) goes.SubscriptionID {
+	id, err := c.subscribe(0, callback)
+	if err != nil {
+		c.subscriptions.SetErr(err)
+	}
+	return id
+}
+
+//SubscribeFrom replays the events stored from fromPosition onwards to the callback,
+//then delivers events as they are stored.
+func (c *Client) SubscribeFrom(fromPosition int64, callback goes.EventPublishedCallback) (goes.SubscriptionID, error) {
+	if fromPosition < 1 {
+		fromPosition = 1
+	}
+	return c.subscribe(fromPosition, callback)
+}
+
+//subscribe opens a subscription, returning once the server has confirmed it.
+func (c *Client) subscribe(fromPosition int64, callback goes.EventPublishedCallback) (goes.SubscriptionID, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.client.Subscribe(ctx, &SubscribeRequest{FromPosition: fromPosition})
+	if err != nil {
+		cancel()
+		return "", fromStatus(err)
+	}
+
+	//The server sends the headers once it has subscribed; a stream ended without
+	//headers carries the reason it failed
+	header, err := stream.Header()
+	if err == nil && header == nil {
+		_, err = stream.Recv()
+	}
+	if err != nil {
+		cancel()
+		return "", fromStatus(err)
+	}
+
+	id, sub, err := c.subscriptions.Add(cancel)
+	if err != nil {
+		return "", err
+	}
+
+	go c.receive(id, sub, stream, callback)
+
+	return id, nil
+}
+
+//receive delivers the events sent on a subscription to the callback, until the
+//subscription is cancelled, the stream is lost, or an event cannot be decoded.
+func (c *Client) receive(id goes.SubscriptionID, sub *subscription.Remote, stream grpc.ServerStreamingClient[Event], callback goes.EventPublishedCallback) {
+	for {
+		pe, err := stream.Recv()
+		if sub.Ended() {
+			return
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("Subscription ended by server")
+			}
+			c.subscriptions.End(id, fmt.Errorf("Subscription lost: %w", fromStatus(err)))
+			return
+		}
+
+		//An event that cannot be decoded ends the subscription rather than being skipped
+		events, err := c.decode([]*Event{pe})
+		if err != nil {
+			c.subscriptions.End(id, fmt.Errorf("Subscription ended: %w", err))
+			return
+		}
+		callback(events[0])
+	}
+}
+
+//Unsubscribe closes the subscription. No events are delivered to the callback once
+//Unsubscribe returns, other than one already being delivered.
+func (c *Client) Unsubscribe(subscriptionID goes.SubscriptionID) {
+	c.subscriptions.End(subscriptionID, nil)
+}
+
+//Done returns a channel that is closed once the subscription ends, either because it was
+//closed or because it failed, in which case the error is reported by Err.
+func (c *Client) Done(subscriptionID goes.SubscriptionID) <-chan struct{} {
+	return c.subscriptions.Done(subscriptionID)
+}
+
+//Close closes every subscription. The connection is left open.
+func (c *Client) Close() error {
+	c.subscriptions.Close()
+	return nil
+}
+
+//Err returns the last error receiving events on a subscription.
+func (c *Client) Err() error {
+	return c.subscriptions.Err()
+}
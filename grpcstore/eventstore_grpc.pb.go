@@ -0,0 +1,257 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: eventstore.proto
+
+package grpcstore
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EventStore_AppendToStream_FullMethodName = "/goes.eventstore.EventStore/AppendToStream"
+	EventStore_ReadStream_FullMethodName     = "/goes.eventstore.EventStore/ReadStream"
+	EventStore_ReadAll_FullMethodName        = "/goes.eventstore.EventStore/ReadAll"
+	EventStore_Subscribe_FullMethodName      = "/goes.eventstore.EventStore/Subscribe"
+)
+
+// EventStoreClient is the client API for EventStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EventStore exposes a goes event store. Payloads are carried as serialized bytes;
+// clients encode and decode them with their own codecs.
+type EventStoreClient interface {
+	// AppendToStream appends events to an aggregate's stream.
+	AppendToStream(ctx context.Context, in *AppendToStreamRequest, opts ...grpc.CallOption) (*AppendToStreamResponse, error)
+	// ReadStream reads an aggregate's events, or a range of them by version.
+	ReadStream(ctx context.Context, in *ReadStreamRequest, opts ...grpc.CallOption) (*ReadStreamResponse, error)
+	// ReadAll reads the store's global log.
+	ReadAll(ctx context.Context, in *ReadAllRequest, opts ...grpc.CallOption) (*ReadAllResponse, error)
+	// Subscribe streams events as they are stored, optionally replaying the log from
+	// a position first. The response headers are sent once the subscription is in
+	// place.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type eventStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventStoreClient(cc grpc.ClientConnInterface) EventStoreClient {
+	return &eventStoreClient{cc}
+}
+
+func (c *eventStoreClient) AppendToStream(ctx context.Context, in *AppendToStreamRequest, opts ...grpc.CallOption) (*AppendToStreamResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendToStreamResponse)
+	err := c.cc.Invoke(ctx, EventStore_AppendToStream_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventStoreClient) ReadStream(ctx context.Context, in *ReadStreamRequest, opts ...grpc.CallOption) (*ReadStreamResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReadStreamResponse)
+	err := c.cc.Invoke(ctx, EventStore_ReadStream_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventStoreClient) ReadAll(ctx context.Context, in *ReadAllRequest, opts ...grpc.CallOption) (*ReadAllResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReadAllResponse)
+	err := c.cc.Invoke(ctx, EventStore_ReadAll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventStoreClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventStore_ServiceDesc.Streams[0], EventStore_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventStore_SubscribeClient = grpc.ServerStreamingClient[Event]
+
+// EventStoreServer is the server API for EventStore service.
+// All implementations must embed UnimplementedEventStoreServer
+// for forward compatibility.
+//
+// EventStore exposes a goes event store. Payloads are carried as serialized bytes;
+// clients encode and decode them with their own codecs.
+type EventStoreServer interface {
+	// AppendToStream appends events to an aggregate's stream.
+	AppendToStream(context.Context, *AppendToStreamRequest) (*AppendToStreamResponse, error)
+	// ReadStream reads an aggregate's events, or a range of them by version.
+	ReadStream(context.Context, *ReadStreamRequest) (*ReadStreamResponse, error)
+	// ReadAll reads the store's global log.
+	ReadAll(context.Context, *ReadAllRequest) (*ReadAllResponse, error)
+	// Subscribe streams events as they are stored, optionally replaying the log from
+	// a position first. The response headers are sent once the subscription is in
+	// place.
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedEventStoreServer()
+}
+
+// UnimplementedEventStoreServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEventStoreServer struct{}
+
+func (UnimplementedEventStoreServer) AppendToStream(context.Context, *AppendToStreamRequest) (*AppendToStreamResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendToStream not implemented")
+}
+func (UnimplementedEventStoreServer) ReadStream(context.Context, *ReadStreamRequest) (*ReadStreamResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadStream not implemented")
+}
+func (UnimplementedEventStoreServer) ReadAll(context.Context, *ReadAllRequest) (*ReadAllResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadAll not implemented")
+}
+func (UnimplementedEventStoreServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedEventStoreServer) mustEmbedUnimplementedEventStoreServer() {}
+func (UnimplementedEventStoreServer) testEmbeddedByValue()                    {}
+
+// UnsafeEventStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventStoreServer will
+// result in compilation errors.
+type UnsafeEventStoreServer interface {
+	mustEmbedUnimplementedEventStoreServer()
+}
+
+func RegisterEventStoreServer(s grpc.ServiceRegistrar, srv EventStoreServer) {
+	// If the following call pancis, it indicates UnimplementedEventStoreServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EventStore_ServiceDesc, srv)
+}
+
+func _EventStore_AppendToStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendToStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventStoreServer).AppendToStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventStore_AppendToStream_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventStoreServer).AppendToStream(ctx, req.(*AppendToStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventStore_ReadStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventStoreServer).ReadStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventStore_ReadStream_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventStoreServer).ReadStream(ctx, req.(*ReadStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventStore_ReadAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventStoreServer).ReadAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventStore_ReadAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventStoreServer).ReadAll(ctx, req.(*ReadAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventStore_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventStoreServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventStore_SubscribeServer = grpc.ServerStreamingServer[Event]
+
+// EventStore_ServiceDesc is the grpc.ServiceDesc for EventStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goes.eventstore.EventStore",
+	HandlerType: (*EventStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AppendToStream",
+			Handler:    _EventStore_AppendToStream_Handler,
+		},
+		{
+			MethodName: "ReadStream",
+			Handler:    _EventStore_ReadStream_Handler,
+		},
+		{
+			MethodName: "ReadAll",
+			Handler:    _EventStore_ReadAll_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _EventStore_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "eventstore.proto",
+}
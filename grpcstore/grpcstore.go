@@ -0,0 +1,168 @@
+//Package grpcstore exposes an event store as a gRPC service, and provides a client
+//implementing the event store interfaces over that service, so services in different
+//processes can share a store.
+//
+//The service is defined in eventstore.proto. Payloads travel as serialized bytes; the
+//client encodes and decodes them with its codec, so the server never needs to know
+//the payload types.
+package grpcstore
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative eventstore.proto
+
+import (
+	"errors"
+
+	"github.com/xtracdev/goes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	//ErrNotSupported is returned when the store behind the server does not support
+	//the requested operation.
+	ErrNotSupported = errors.New("Operation not supported by event store")
+
+	//ErrPayloadNotSerialized is returned when an event payload is not a []byte and
+	//there is no codec to serialize it.
+	ErrPayloadNotSerialized = errors.New("Event payload is not serialized")
+)
+
+//errorCodes maps the errors the service reports to the codes carried in the Error
+//detail, and to gRPC status codes. The first matching entry is used.
+var errorCodes = []struct {
+	err    error
+	code   string
+	status codes.Code
+}{
+	{goes.ErrConcurrency, "concurrency", codes.Aborted},
+	{goes.ErrAggregateNotFound, "not_found", codes.NotFound},
+	{goes.ErrEventSequence, "event_sequence", codes.InvalidArgument},
+	{goes.ErrUnknownEventType, "unknown_event_type", codes.InvalidArgument},
+	{ErrNotSupported, "not_supported", codes.Unimplemented},
+	{ErrPayloadNotSerialized, "payload_not_serialized", codes.Internal},
+}
+
+//statusError converts an error from the store to a gRPC status error carrying an
+//Error detail.
+func statusError(err error) error {
+	detail := &Error{Code: "internal"}
+	code := codes.Internal
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			detail.Code, code = ec.code, ec.status
+			break
+		}
+	}
+
+	var conflict *goes.ConcurrencyError
+	if errors.As(err, &conflict) {
+		detail.AggregateId = conflict.AggregateID
+		detail.ExpectedVersion = int64(conflict.ExpectedVersion)
+		detail.ActualVersion = int64(conflict.ActualVersion)
+	}
+
+	st := status.New(code, err.Error())
+	if withDetail, err := st.WithDetails(detail); err == nil {
+		st = withDetail
+	}
+	return st.Err()
+}
+
+//remoteError is an error reported by the server. It unwraps to the error its code
+//stands for, so callers can match it with errors.Is.
+type remoteError struct {
+	message string
+	err     error
+}
+
+func (e *remoteError) Error() string {
+	return e.message
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
+
+//fromStatus converts a gRPC status error back to the error the store reported.
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+
+	for _, d := range st.Details() {
+		detail, ok := d.(*Error)
+		if !ok {
+			continue
+		}
+
+		if detail.Code == "concurrency" {
+			return &goes.ConcurrencyError{
+				AggregateID:     detail.AggregateId,
+				ExpectedVersion: int(detail.ExpectedVersion),
+				ActualVersion:   int(detail.ActualVersion),
+			}
+		}
+
+		for _, ec := range errorCodes {
+			if ec.code == detail.Code {
+				return &remoteError{message: st.Message(), err: ec.err}
+			}
+		}
+	}
+
+	//A server without the method at all
+	if st.Code() == codes.Unimplemented {
+		return &remoteError{message: st.Message(), err: ErrNotSupported}
+	}
+	return err
+}
+
+//toProto converts an event to its protobuf form. The payload must already be
+//serialized.
+func toProto(e goes.Event) (*Event, error) {
+	payload, ok := e.Payload.([]byte)
+	if !ok && e.Payload != nil {
+		return nil, ErrPayloadNotSerialized
+	}
+
+	pe := &Event{
+		AggregateId:   e.Source,
+		Version:       int64(e.Version),
+		TypeCode:      e.TypeCode,
+		SchemaVersion: int32(e.SchemaVersion),
+		Position:      e.Position,
+		EventId:       e.EventID,
+		CorrelationId: e.CorrelationID,
+		CausationId:   e.CausationID,
+		Headers:       e.Headers,
+		Payload:       payload,
+	}
+	if !e.Timestamp.IsZero() {
+		pe.Timestamp = timestamppb.New(e.Timestamp)
+	}
+	return pe, nil
+}
+
+//fromProto converts an event from its protobuf form.
+func fromProto(pe *Event) goes.Event {
+	e := goes.Event{
+		Source:        pe.GetAggregateId(),
+		Version:       int(pe.GetVersion()),
+		TypeCode:      pe.GetTypeCode(),
+		SchemaVersion: int(pe.GetSchemaVersion()),
+		Position:      pe.GetPosition(),
+		EventID:       pe.GetEventId(),
+		CorrelationID: pe.GetCorrelationId(),
+		CausationID:   pe.GetCausationId(),
+		Headers:       pe.GetHeaders(),
+	}
+	if pe.Timestamp != nil {
+		e.Timestamp = pe.Timestamp.AsTime()
+	}
+	if pe.Payload != nil {
+		e.Payload = pe.Payload
+	}
+	return e
+}
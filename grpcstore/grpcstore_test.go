@@ -0,0 +1,169 @@
+package grpcstore_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/grpcstore"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+	"github.com/xtracdev/goes/storetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+//newClient serves the store over an in memory connection and returns a client for it.
+func newClient(t *testing.T, server *grpcstore.Server) *grpcstore.Client {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	grpcstore.RegisterEventStoreServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := grpcstore.NewClient(conn)
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+		grpcServer.Stop()
+	})
+	return client
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) goes.EventStore {
+		return newClient(t, grpcstore.NewServer(inmemes.NewInMemoryEventStore())).WithCodec(storetest.Codecs)
+	})
+}
+
+func TestConcurrencyConflict(t *testing.T) {
+	client := newClient(t, grpcstore.NewServer(inmemes.NewInMemoryEventStore())).WithCodec(sample.Codecs)
+
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(client))
+
+	err = client.StoreEventsExpecting(&goes.Aggregate{
+		AggregateID: user.AggregateID,
+		Version:     1,
+		Events:      []goes.Event{{Source: user.AggregateID, Version: 1, TypeCode: "X", Payload: []byte("{}")}},
+	}, goes.ExpectNoStream)
+	assert.True(t, errors.Is(err, goes.ErrConcurrency))
+	var conflict *goes.ConcurrencyError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, user.AggregateID, conflict.AggregateID)
+		assert.Equal(t, 1, conflict.ActualVersion)
+	}
+
+	_, err = client.RetrieveEvents("no-such-aggregate")
+	assert.True(t, errors.Is(err, goes.ErrAggregateNotFound))
+}
+
+func TestServerEncodesDeserializedPayloads(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+
+	client := newClient(t, grpcstore.NewServer(store).WithCodec(sample.Codecs)).WithCodec(sample.Codecs)
+	loaded, err := sample.NewUserRepository(client).Load(user.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", loaded.FirstName)
+}
+
+func TestSubscribeFromReplaysHistory(t *testing.T) {
+	t.Run("CatchUpSubscriber", func(t *testing.T) {
+		testSubscribeFrom(t, inmemes.NewInMemoryEventStore())
+	})
+	t.Run("EventLogReader", func(t *testing.T) {
+		store, err := filestore.NewFileEventStore(t.TempDir())
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer store.Close()
+		testSubscribeFrom(t, store)
+	})
+}
+
+func testSubscribeFrom(t *testing.T, store goes.EventStore) {
+	client := newClient(t, grpcstore.NewServer(store)).WithCodec(sample.Codecs)
+
+	for _, name := range []string{"one", "two"} {
+		user, err := sample.NewUser(name, "last", "email")
+		assert.Nil(t, err)
+		assert.Nil(t, user.Store(client))
+	}
+
+	var mu sync.Mutex
+	var positions []int64
+	_, err := client.SubscribeFrom(2, func(e goes.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		positions = append(positions, e.Position)
+	})
+	assert.Nil(t, err)
+
+	user, err := sample.NewUser("three", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(client))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return assert.ObjectsAreEqual([]int64{2, 3}, positions)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, client.Err())
+
+	head, err := client.HeadPosition()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), head)
+}
+
+func TestSubscriptionEndsOnUndecodableEvent(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	client := newClient(t, grpcstore.NewServer(store)).WithCodec(sample.Codecs)
+
+	var delivered []goes.Event
+	id := client.SubscribeEvents(func(e goes.Event) { delivered = append(delivered, e) })
+	assert.Nil(t, client.Err())
+
+	//The event's payload is not valid for its type, so the client cannot decode it
+	assert.Nil(t, store.StoreEvents(&goes.Aggregate{AggregateID: "broken", Version: 1, Events: []goes.Event{
+		{Source: "broken", Version: 1, TypeCode: sample.UserCreatedTypeCode, Payload: []byte("not json")},
+	}}))
+
+	select {
+	case <-client.Done(id):
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription did not end")
+	}
+	assert.NotNil(t, client.Err())
+	assert.Empty(t, delivered)
+}
+
+func TestUnsupportedOperations(t *testing.T) {
+	store := struct{ goes.EventStore }{inmemes.NewInMemoryEventStore()}
+	client := newClient(t, grpcstore.NewServer(store))
+
+	_, err := client.ReadEventLog(1, 0)
+	assert.True(t, errors.Is(err, grpcstore.ErrNotSupported))
+
+	_, err = client.SubscribeFrom(1, func(goes.Event) {})
+	assert.True(t, errors.Is(err, grpcstore.ErrNotSupported))
+}
@@ -0,0 +1,166 @@
+package grpcstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/internal/subscription"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//Server implements the EventStore service for an event store. Calls the store does
+//not support, such as reading the global log from a store that does not keep one,
+//fail with codes.Unimplemented. Register it with RegisterEventStoreServer.
+type Server struct {
+	UnimplementedEventStoreServer
+	store goes.EventStore
+	codec goes.EventCodec
+}
+
+//NewServer creates a server for the event store.
+func NewServer(store goes.EventStore) *Server {
+	return &Server{store: store}
+}
+
+//WithCodec sets a codec used to serialize the payloads of events read from a store
+//holding deserialized payloads, such as an in memory store without a codec of its own.
+func (s *Server) WithCodec(codec goes.EventCodec) *Server {
+	s.codec = codec
+	return s
+}
+
+//protoEvents converts the events read from the store to their protobuf form.
+func (s *Server) protoEvents(events []goes.Event) ([]*Event, error) {
+	converted := make([]*Event, 0, len(events))
+	for _, e := range events {
+		if s.codec != nil {
+			var err error
+			if e, err = s.codec.EncodeEvent(e); err != nil {
+				return nil, err
+			}
+		}
+
+		pe, err := toProto(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %T payload for event type %s", err, e.Payload, e.TypeCode)
+		}
+		converted = append(converted, pe)
+	}
+	return converted, nil
+}
+
+//AppendToStream appends the events in the request to the aggregate.
+func (s *Server) AppendToStream(ctx context.Context, req *AppendToStreamRequest) (*AppendToStreamResponse, error) {
+	agg := &goes.Aggregate{AggregateID: req.GetAggregateId(), Version: int(req.GetVersion())}
+	for _, pe := range req.GetEvents() {
+		e := fromProto(pe)
+		e.Source = agg.AggregateID
+		agg.Events = append(agg.Events, e)
+	}
+
+	var err error
+	if req.ExpectedVersion == nil {
+		err = s.store.StoreEvents(agg)
+	} else if evStore, ok := s.store.(goes.ExpectedVersionStore); ok {
+		err = evStore.StoreEventsExpecting(agg, goes.ExpectedVersion(req.GetExpectedVersion()))
+	} else {
+		err = ErrNotSupported
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &AppendToStreamResponse{Version: int64(agg.Version)}, nil
+}
+
+//ReadStream reads the aggregate's events, or the range of them selected by the request.
+func (s *Server) ReadStream(ctx context.Context, req *ReadStreamRequest) (*ReadStreamResponse, error) {
+	query := goes.RangeQuery{
+		FromVersion: int(req.GetFromVersion()),
+		ToVersion:   int(req.GetToVersion()),
+		Backward:    req.GetBackward(),
+		MaxEvents:   int(req.GetMaxEvents()),
+	}
+
+	var events []goes.Event
+	var err error
+	if query == (goes.RangeQuery{}) {
+		events, err = s.store.RetrieveEvents(req.GetAggregateId())
+	} else {
+		events, err = goes.RetrieveEventRange(s.store, req.GetAggregateId(), query)
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	converted, err := s.protoEvents(events)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &ReadStreamResponse{Events: converted}, nil
+}
+
+//ReadAll reads the global log, returning the log's head position with the events.
+func (s *Server) ReadAll(ctx context.Context, req *ReadAllRequest) (*ReadAllResponse, error) {
+	logReader, ok := s.store.(goes.EventLogReader)
+	if !ok {
+		return nil, statusError(ErrNotSupported)
+	}
+
+	head, err := logReader.HeadPosition()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	events, err := logReader.ReadEventLog(req.GetFromPosition(), int(req.GetMaxEvents()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	converted, err := s.protoEvents(events)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &ReadAllResponse{Events: converted, HeadPosition: head}, nil
+}
+
+//Subscribe streams the events published by the store. Given a from position, the
+//stored events from that position onwards are replayed first; this needs a store
+//implementing goes.CatchUpSubscriber or goes.EventLogReader.
+//
+//The response headers are sent once the subscription is in place, so a client that
+//has received them will be sent every event stored from then on.
+func (s *Server) Subscribe(req *SubscribeRequest, stream grpc.ServerStreamingServer[Event]) error {
+	sub, err := subscription.New(s.store, req.GetFromPosition())
+	if errors.Is(err, subscription.ErrNotSupported) {
+		err = ErrNotSupported
+	}
+	if err != nil {
+		return statusError(err)
+	}
+	defer sub.Close()
+
+	if err := stream.SendHeader(metadata.Pairs("subscribed", "true")); err != nil {
+		return err
+	}
+
+	for {
+		events, ok := sub.Next(stream.Context().Done())
+		if !ok {
+			return nil
+		}
+
+		converted, err := s.protoEvents(events)
+		if err != nil {
+			return statusError(err)
+		}
+		for _, pe := range converted {
+			if err := stream.Send(pe); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package httpstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/internal/subscription"
+)
+
+//Client implements the EventStore, ExpectedVersionStore, BatchStore, EventRangeReader,
+//EventLogReader, EventPublisher, CatchUpSubscriber and EventRepublisher interfaces
+//against a Server. Operations the store behind the server does not support return
+//ErrNotSupported.
+//
+//Each subscription holds open a Server-Sent Events connection, so the http.Client
+//used must not set a timeout. A subscription ends if its connection is lost or an event
+//sent on it cannot be decoded; the channel returned by Done is closed, and the error is
+//reported by Err.
+type Client struct {
+	baseURL       string
+	client        *http.Client
+	codec         goes.EventCodec
+	subscriptions *subscription.Remotes
+}
+
+//NewClient creates a client for the server at baseURL, making requests with the
+//given client, or with http.DefaultClient if client is nil.
+func NewClient(baseURL string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		client:        client,
+		subscriptions: subscription.NewRemotes(),
+	}
+}
+
+//WithCodec sets a codec used to encode event payloads before they are sent to the
+//server, and decode them when they are read or published.
+func (c *Client) WithCodec(codec goes.EventCodec) *Client {
+	c.codec = codec
+	return c
+}
+
+func streamPath(aggregateID string) string {
+	return "/streams/" + url.PathEscape(aggregateID)
+}
+
+//do sends a request with v as its JSON body, and decodes the JSON response into out
+//unless out is nil. Error responses are returned as errors matching the error the
+//server reported.
+func (c *Client) do(ctx context.Context, method, path string, v interface{}, out interface{}) error {
+	var body io.Reader
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+//responseError returns the error reported by an error response.
+func responseError(resp *http.Response) error {
+	var response errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error == "" {
+		return fmt.Errorf("Event store server returned %s", resp.Status)
+	}
+
+	if response.Code == "concurrency" {
+		return &goes.ConcurrencyError{
+			AggregateID:     response.AggregateID,
+			ExpectedVersion: response.ExpectedVersion,
+			ActualVersion:   response.ActualVersion,
+		}
+	}
+
+	remote := &remoteError{message: response.Error}
+	for _, ec := range errorCodes {
+		if ec.code == response.Code {
+			remote.err = ec.err
+			break
+		}
+	}
+	return remote
+}
+
+//encode serializes the events to their JSON form.
+func (c *Client) encode(events []goes.Event) ([]wireEvent, error) {
+	converted := make([]wireEvent, 0, len(events))
+	for _, e := range events {
+		if c.codec != nil {
+			var err error
+			if e, err = c.codec.EncodeEvent(e); err != nil {
+				return nil, err
+			}
+		}
+
+		we, err := toWire(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %T payload for event type %s", err, e.Payload, e.TypeCode)
+		}
+		converted = append(converted, we)
+	}
+	return converted, nil
+}
+
+//decode converts events from their JSON form, decoding the payloads.
+func (c *Client) decode(events []wireEvent) ([]goes.Event, error) {
+	converted := make([]goes.Event, 0, len(events))
+	for _, we := range events {
+		e := fromWire(we)
+		if c.codec != nil {
+			var err error
+			if e, err = c.codec.DecodeEvent(e); err != nil {
+				return nil, err
+			}
+		}
+		converted = append(converted, e)
+	}
+	return converted, nil
+}
+
+func (c *Client) appendEvents(agg *goes.Aggregate, expected *int) (int, error) {
+	events, err := c.encode(agg.Events)
+	if err != nil {
+		return 0, err
+	}
+
+	var response appendResponse
+	request := appendRequest{Version: agg.Version, ExpectedVersion: expected, Events: events}
+	if err := c.do(context.Background(), http.MethodPost, streamPath(agg.AggregateID), request, &response); err != nil {
+		return 0, err
+	}
+	return response.Version, nil
+}
+
+//StoreEvents stores the aggregate's events. The events must follow on from the version
+//already stored, otherwise a ConcurrencyError is returned.
+func (c *Client) StoreEvents(agg *goes.Aggregate) error {
+	_, err := c.appendEvents(agg, nil)
+	return err
+}
+
+//StoreEventsExpecting stores the aggregate's events if the stored aggregate satisfies
+//the expected version. With ExpectAny the events are renumbered to follow on from the
+//version stored, and agg.Version is updated to match.
+func (c *Client) StoreEventsExpecting(agg *goes.Aggregate, expected goes.ExpectedVersion) error {
+	ev := int(expected)
+	version, err := c.appendEvents(agg, &ev)
+	if err != nil {
+		return err
+	}
+
+	if expected == goes.ExpectAny {
+		first := version - len(agg.Events) + 1
+		for i := range agg.Events {
+			agg.Events[i].Version = first + i
+		}
+		agg.Version = version
+	}
+	return nil
+}
+
+//StoreBatch stores the events of all the aggregates, or none of them.
+func (c *Client) StoreBatch(aggs ...*goes.Aggregate) error {
+	if err := goes.CheckBatch(aggs); err != nil {
+		return err
+	}
+
+	var request batchRequest
+	for _, agg := range aggs {
+		events, err := c.encode(agg.Events)
+		if err != nil {
+			return err
+		}
+		request.Aggregates = append(request.Aggregates, batchAggregate{
+			AggregateID: agg.AggregateID,
+			Version:     agg.Version,
+			Events:      events,
+		})
+	}
+
+	return c.do(context.Background(), http.MethodPost, "/batch", request, nil)
+}
+
+//readEvents reads the events from the path.
+func (c *Client) readEvents(path string) ([]goes.Event, error) {
+	var response eventsResponse
+	if err := c.do(context.Background(), http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return c.decode(response.Events)
+}
+
+//RetrieveEvents retrieves the events stored for the aggregate.
+func (c *Client) RetrieveEvents(aggregateID string) ([]goes.Event, error) {
+	return c.readEvents(streamPath(aggregateID))
+}
+
+//RetrieveEventRange retrieves the range of the aggregate's events selected by the
+//query.
+func (c *Client) RetrieveEventRange(aggregateID string, query goes.RangeQuery) ([]goes.Event, error) {
+	params := url.Values{}
+	params.Set("from", strconv.Itoa(query.FromVersion))
+	params.Set("to", strconv.Itoa(query.ToVersion))
+	params.Set("backward", strconv.FormatBool(query.Backward))
+	params.Set("max", strconv.Itoa(query.MaxEvents))
+	return c.readEvents(streamPath(aggregateID) + "?" + params.Encode())
+}
+
+//ReadEventLog reads up to maxEvents events from the global log, starting at
+//fromPosition.
+func (c *Client) ReadEventLog(fromPosition int64, maxEvents int) ([]goes.Event, error) {
+	params := url.Values{}
+	params.Set("from", strconv.FormatInt(fromPosition, 10))
+	params.Set("max", strconv.Itoa(maxEvents))
+	return c.readEvents("/log?" + params.Encode())
+}
+
+//HeadPosition returns the position of the last event written to the global log.
+func (c *Client) HeadPosition() (int64, error) {
+	var response headResponse
+	if err := c.do(context.Background(), http.MethodGet, "/log/head", nil, &response); err != nil {
+		return 0, err
+	}
+	return response.Position, nil
+}
+
+//RepublishAllEvents asks the server to republish every stored event to the subscribers.
+func (c *Client) RepublishAllEvents() error {
+	return c.do(context.Background(), http.MethodPost, "/republish", nil, nil)
+}
+
+//SubscribeEvents registers the callback as a subscriber to the events stored from now
+//on. If the subscription cannot be made the error is reported by Err.
+func (c *Client) SubscribeEvents(callback goes.EventPublishedCallback) goes.SubscriptionID {
+	id, err := c.subscribe(0, callback)
+	if err != nil {
+		c.subscriptions.SetErr(err)
+	}
+	return id
+}
+
+//SubscribeFrom replays the events stored from fromPosition onwards to the callback,
+//then delivers events as they are stored.
+func (c *Client) SubscribeFrom(fromPosition int64, callback goes.EventPublishedCallback) (goes.SubscriptionID, error) {
+	if fromPosition < 1 {
+		fromPosition = 1
+	}
+	return c.subscribe(fromPosition, callback)
+}
+
+//subscribe opens a subscription, returning once the server has confirmed it.
+func (c *Client) subscribe(fromPosition int64, callback goes.EventPublishedCallback) (goes.SubscriptionID, error) {
+	path := "/subscribe"
+	if fromPosition > 0 {
+		path += "?from=" + strconv.FormatInt(fromPosition, 10)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		cancel()
+		return "", err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		cancel()
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		cancel()
+		return "", responseError(resp)
+	}
+
+	id, sub, err := c.subscriptions.Add(cancel)
+	if err != nil {
+		resp.Body.Close()
+		return "", err
+	}
+
+	go c.receive(id, sub, resp.Body, callback)
+
+	return id, nil
+}
+
+//receive reads the events sent on a subscription and delivers them to the callback,
+//until the subscription is cancelled, the connection is lost, or an event cannot be
+//decoded.
+func (c *Client) receive(id goes.SubscriptionID, sub *subscription.Remote, body io.ReadCloser, callback goes.EventPublishedCallback) {
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	var eventType, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if !sub.Ended() {
+				c.subscriptions.End(id, fmt.Errorf("Subscription lost: %w", err))
+			}
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			continue
+		case line != "":
+			continue
+		}
+
+		//A blank line ends the event
+		if data == "" {
+			continue
+		}
+		if eventType == "error" {
+			c.subscriptions.End(id, fmt.Errorf("Subscription ended by server: %s", data))
+			return
+		}
+
+		var we wireEvent
+		if err := json.Unmarshal([]byte(data), &we); err != nil {
+			c.subscriptions.End(id, err)
+			return
+		}
+		eventType, data = "", ""
+
+		//An event that cannot be decoded ends the subscription rather than being skipped
+		events, err := c.decode([]wireEvent{we})
+		if err != nil {
+			c.subscriptions.End(id, fmt.Errorf("Subscription ended: %w", err))
+			return
+		}
+
+		if sub.Ended() {
+			return
+		}
+		callback(events[0])
+	}
+}
+
+//Unsubscribe closes the subscription. No events are delivered to the callback once
+//Unsubscribe returns, other than one already being delivered.
+func (c *Client) Unsubscribe(subscriptionID goes.SubscriptionID) {
+	c.subscriptions.End(subscriptionID, nil)
+}
+
+//Done returns a channel that is closed once the subscription ends, either because it was
+//closed or because it failed, in which case the error is reported by Err.
+func (c *Client) Done(subscriptionID goes.SubscriptionID) <-chan struct{} {
+	return c.subscriptions.Done(subscriptionID)
+}
+
+//Close closes every subscription.
+func (c *Client) Close() error {
+	c.subscriptions.Close()
+	return nil
+}
+
+//Err returns the last error receiving events on a subscription.
+func (c *Client) Err() error {
+	return c.subscriptions.Err()
+}
@@ -0,0 +1,201 @@
+package httpstore_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/filestore"
+	"github.com/xtracdev/goes/httpstore"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+	"github.com/xtracdev/goes/storetest"
+)
+
+//newClient starts a server for the store and returns a client for it.
+func newClient(t *testing.T, server *httpstore.Server) *httpstore.Client {
+	ts := httptest.NewServer(server)
+	client := httpstore.NewClient(ts.URL, nil)
+	t.Cleanup(func() {
+		client.Close()
+		ts.Close()
+	})
+	return client
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) goes.EventStore {
+		return newClient(t, httpstore.NewServer(inmemes.NewInMemoryEventStore())).WithCodec(storetest.Codecs)
+	})
+}
+
+func TestConflictReturns409(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	ts := httptest.NewServer(httpstore.NewServer(store))
+	defer ts.Close()
+	client := httpstore.NewClient(ts.URL, nil).WithCodec(sample.Codecs)
+
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(client))
+
+	//A second writer appending at the same version loses
+	stale := &goes.Aggregate{
+		AggregateID: user.AggregateID,
+		Version:     1,
+		Events:      []goes.Event{{Source: user.AggregateID, Version: 1, TypeCode: "X", Payload: []byte("{}")}},
+	}
+	err = client.StoreEvents(stale)
+	assert.True(t, errors.Is(err, goes.ErrConcurrency))
+	var conflict *goes.ConcurrencyError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, 1, conflict.ActualVersion)
+	}
+
+	resp, err := http.Post(ts.URL+"/streams/"+user.AggregateID, "application/json",
+		bytes.NewBufferString(`{"version":1,"expectedVersion":0,"events":[{"version":1,"typeCode":"X"}]}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestReadStreamRange(t *testing.T) {
+	client := newClient(t, httpstore.NewServer(inmemes.NewInMemoryEventStore())).WithCodec(storetest.Codecs)
+
+	//Aggregate IDs may contain slashes
+	agg := &goes.Aggregate{AggregateID: "orders/42"}
+	for _, name := range []string{"one", "two", "three", "four"} {
+		agg.Version++
+		agg.Events = append(agg.Events, goes.Event{
+			Source:   agg.AggregateID,
+			Version:  agg.Version,
+			TypeCode: storetest.TestEventTypeCode,
+			Payload:  storetest.TestEvent{Name: name},
+		})
+	}
+	assert.Nil(t, client.StoreEvents(agg))
+
+	events, err := client.RetrieveEventRange("orders/42", goes.RangeQuery{FromVersion: 2, ToVersion: 3, Backward: true})
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, storetest.TestEvent{Name: "three"}, events[0].Payload)
+		assert.Equal(t, storetest.TestEvent{Name: "two"}, events[1].Payload)
+	}
+
+	_, err = client.RetrieveEvents("orders/43")
+	assert.True(t, errors.Is(err, goes.ErrAggregateNotFound))
+}
+
+func TestServerEncodesDeserializedPayloads(t *testing.T) {
+	//The store holds the events as they were produced, with no codec of its own
+	store := inmemes.NewInMemoryEventStore()
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+
+	client := newClient(t, httpstore.NewServer(store).WithCodec(sample.Codecs)).WithCodec(sample.Codecs)
+	loaded, err := sample.NewUserRepository(client).Load(user.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", loaded.FirstName)
+}
+
+func TestSubscribeFromReplaysHistory(t *testing.T) {
+	//The in memory store replays history itself, and the file store from its log
+	t.Run("CatchUpSubscriber", func(t *testing.T) {
+		testSubscribeFrom(t, inmemes.NewInMemoryEventStore())
+	})
+	t.Run("EventLogReader", func(t *testing.T) {
+		store, err := filestore.NewFileEventStore(t.TempDir())
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer store.Close()
+		testSubscribeFrom(t, store)
+	})
+}
+
+func testSubscribeFrom(t *testing.T, store goes.EventStore) {
+	client := newClient(t, httpstore.NewServer(store)).WithCodec(sample.Codecs)
+
+	for _, name := range []string{"one", "two"} {
+		user, err := sample.NewUser(name, "last", "email")
+		assert.Nil(t, err)
+		assert.Nil(t, user.Store(client))
+	}
+
+	var mu sync.Mutex
+	var positions []int64
+	_, err := client.SubscribeFrom(2, func(e goes.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		positions = append(positions, e.Position)
+	})
+	assert.Nil(t, err)
+
+	user, err := sample.NewUser("three", "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(client))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return assert.ObjectsAreEqual([]int64{2, 3}, positions)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, client.Err())
+}
+
+func TestSubscriptionEndsOnFailure(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	ts := httptest.NewServer(httpstore.NewServer(store))
+	client := httpstore.NewClient(ts.URL, nil).WithCodec(sample.Codecs)
+	defer client.Close()
+
+	var delivered []goes.Event
+	id := client.SubscribeEvents(func(e goes.Event) { delivered = append(delivered, e) })
+	assert.Nil(t, client.Err())
+
+	//The event's payload is not valid for its type, so the client cannot decode it
+	undecodable := &goes.Aggregate{AggregateID: "broken", Version: 1, Events: []goes.Event{
+		{Source: "broken", Version: 1, TypeCode: sample.UserCreatedTypeCode, Payload: []byte("not json")},
+	}}
+	assert.Nil(t, store.StoreEvents(undecodable))
+
+	select {
+	case <-client.Done(id):
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription did not end")
+	}
+	assert.NotNil(t, client.Err())
+	assert.Empty(t, delivered)
+
+	//Losing the connection also ends a subscription
+	id = client.SubscribeEvents(func(goes.Event) {})
+	ts.CloseClientConnections()
+	ts.Close()
+	select {
+	case <-client.Done(id):
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription did not end")
+	}
+}
+
+func TestUnsupportedOperations(t *testing.T) {
+	//A store offering nothing beyond the EventStore interface
+	store := struct{ goes.EventStore }{inmemes.NewInMemoryEventStore()}
+	client := newClient(t, httpstore.NewServer(store))
+
+	_, err := client.ReadEventLog(1, 0)
+	assert.True(t, errors.Is(err, httpstore.ErrNotSupported))
+
+	_, err = client.SubscribeFrom(1, func(goes.Event) {})
+	assert.True(t, errors.Is(err, httpstore.ErrNotSupported))
+
+	err = client.StoreBatch(&goes.Aggregate{AggregateID: "a"})
+	assert.True(t, errors.Is(err, goes.ErrBatchNotSupported))
+}
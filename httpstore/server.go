@@ -0,0 +1,391 @@
+package httpstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/internal/subscription"
+)
+
+//Server is an http.Handler exposing an event store. Operations the store does not
+//support, such as reading the global log from a store that does not keep one, are
+//answered with 501 Not Implemented.
+type Server struct {
+	store goes.EventStore
+	codec goes.EventCodec
+}
+
+//NewServer creates a server for the event store.
+func NewServer(store goes.EventStore) *Server {
+	return &Server{store: store}
+}
+
+//WithCodec sets a codec used to serialize the payloads of events read from a store
+//holding deserialized payloads, such as an in memory store without a codec of its own.
+func (s *Server) WithCodec(codec goes.EventCodec) *Server {
+	s.codec = codec
+	return s
+}
+
+//streamsPrefix is the path prefix of the aggregate stream endpoints. Aggregate IDs
+//may contain slashes, so everything after the prefix is the ID.
+const streamsPrefix = "/streams/"
+
+//ServeHTTP handles a request to the API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.Path
+	if strings.HasPrefix(r.URL.Path, streamsPrefix) {
+		route = r.Method + " " + streamsPrefix
+	}
+
+	switch route {
+	case "POST " + streamsPrefix:
+		s.appendEvents(w, r)
+	case "GET " + streamsPrefix:
+		s.readStream(w, r)
+	case "POST /batch":
+		s.appendBatch(w, r)
+	case "GET /log":
+		s.readLog(w, r)
+	case "GET /log/head":
+		s.readHead(w, r)
+	case "GET /subscribe":
+		s.subscribe(w, r)
+	case "POST /republish":
+		s.republish(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "No such endpoint: " + route, Code: "no_endpoint"})
+	}
+}
+
+//aggregateID returns the aggregate ID from the path of a stream request.
+func aggregateID(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, streamsPrefix)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+//writeError writes the error response for err.
+func writeError(w http.ResponseWriter, err error) {
+	response := errorResponse{Error: err.Error(), Code: "internal"}
+	status := http.StatusInternalServerError
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			response.Code, status = ec.code, ec.status
+			break
+		}
+	}
+
+	var conflict *goes.ConcurrencyError
+	if errors.As(err, &conflict) {
+		response.AggregateID = conflict.AggregateID
+		response.ExpectedVersion = conflict.ExpectedVersion
+		response.ActualVersion = conflict.ActualVersion
+	}
+
+	writeJSON(w, status, response)
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrBadRequest, fmt.Sprintf(format, args...))
+}
+
+//intParam returns the value of the named query parameter, or zero if it is not set.
+func intParam(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, badRequest("query parameter %s: %v", name, err)
+	}
+	return n, nil
+}
+
+//wireEvents converts the events read from the store to their JSON form.
+func (s *Server) wireEvents(events []goes.Event) ([]wireEvent, error) {
+	converted := make([]wireEvent, 0, len(events))
+	for _, e := range events {
+		if s.codec != nil {
+			var err error
+			if e, err = s.codec.EncodeEvent(e); err != nil {
+				return nil, err
+			}
+		}
+
+		we, err := toWire(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %T payload for event type %s", err, e.Payload, e.TypeCode)
+		}
+		converted = append(converted, we)
+	}
+	return converted, nil
+}
+
+//writeEvents writes the events read from the store as an eventsResponse.
+func (s *Server) writeEvents(w http.ResponseWriter, events []goes.Event) {
+	converted, err := s.wireEvents(events)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, eventsResponse{Events: converted})
+}
+
+//aggregate builds the aggregate to store from the events in a request.
+func aggregate(id string, version int, events []wireEvent) *goes.Aggregate {
+	agg := &goes.Aggregate{AggregateID: id, Version: version}
+	for _, we := range events {
+		e := fromWire(we)
+		e.Source = id
+		agg.Events = append(agg.Events, e)
+	}
+	return agg
+}
+
+func (s *Server) appendEvents(w http.ResponseWriter, r *http.Request) {
+	id := aggregateID(r)
+	if id == "" {
+		writeError(w, badRequest("missing aggregate ID"))
+		return
+	}
+
+	var request appendRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	agg := aggregate(id, request.Version, request.Events)
+
+	var err error
+	if request.ExpectedVersion == nil {
+		err = s.store.StoreEvents(agg)
+	} else if evStore, ok := s.store.(goes.ExpectedVersionStore); ok {
+		err = evStore.StoreEventsExpecting(agg, goes.ExpectedVersion(*request.ExpectedVersion))
+	} else {
+		err = ErrNotSupported
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appendResponse{Version: agg.Version})
+}
+
+func (s *Server) appendBatch(w http.ResponseWriter, r *http.Request) {
+	batchStore, ok := s.store.(goes.BatchStore)
+	if !ok {
+		writeError(w, goes.ErrBatchNotSupported)
+		return
+	}
+
+	var request batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	aggs := make([]*goes.Aggregate, 0, len(request.Aggregates))
+	for _, ba := range request.Aggregates {
+		if ba.AggregateID == "" {
+			writeError(w, badRequest("missing aggregate ID"))
+			return
+		}
+		aggs = append(aggs, aggregate(ba.AggregateID, ba.Version, ba.Events))
+	}
+
+	if err := batchStore.StoreBatch(aggs...); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//readStream reads an aggregate's events. The from, to, backward and max query
+//parameters select a range of versions as for goes.RangeQuery.
+func (s *Server) readStream(w http.ResponseWriter, r *http.Request) {
+	id := aggregateID(r)
+	if id == "" {
+		writeError(w, badRequest("missing aggregate ID"))
+		return
+	}
+
+	query := r.URL.Query()
+	if !query.Has("from") && !query.Has("to") && !query.Has("backward") && !query.Has("max") {
+		events, err := s.store.RetrieveEvents(id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		s.writeEvents(w, events)
+		return
+	}
+
+	var rq goes.RangeQuery
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"from", &rq.FromVersion}, {"to", &rq.ToVersion}, {"max", &rq.MaxEvents}} {
+		n, err := intParam(r, p.name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		*p.value = int(n)
+	}
+	if backward := query.Get("backward"); backward != "" {
+		var err error
+		if rq.Backward, err = strconv.ParseBool(backward); err != nil {
+			writeError(w, badRequest("query parameter backward: %v", err))
+			return
+		}
+	}
+
+	events, err := goes.RetrieveEventRange(s.store, id, rq)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeEvents(w, events)
+}
+
+//readLog reads the global log from the position given by the from query parameter,
+//returning up to max events.
+func (s *Server) readLog(w http.ResponseWriter, r *http.Request) {
+	logReader, ok := s.store.(goes.EventLogReader)
+	if !ok {
+		writeError(w, ErrNotSupported)
+		return
+	}
+
+	from, err := intParam(r, "from")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	max, err := intParam(r, "max")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	events, err := logReader.ReadEventLog(from, int(max))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeEvents(w, events)
+}
+
+func (s *Server) readHead(w http.ResponseWriter, r *http.Request) {
+	logReader, ok := s.store.(goes.EventLogReader)
+	if !ok {
+		writeError(w, ErrNotSupported)
+		return
+	}
+
+	position, err := logReader.HeadPosition()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, headResponse{Position: position})
+}
+
+func (s *Server) republish(w http.ResponseWriter, r *http.Request) {
+	republisher, ok := s.store.(goes.EventRepublisher)
+	if !ok {
+		writeError(w, ErrNotSupported)
+		return
+	}
+
+	if err := republisher.RepublishAllEvents(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//subscribe streams the events published by the store as Server-Sent Events, each
+//carrying an event as JSON with its log position as the SSE event ID. Given a from
+//query parameter, or a Last-Event-ID header when reconnecting, the stored events
+//from that position onwards are replayed first; this needs a store implementing
+//goes.CatchUpSubscriber or goes.EventLogReader.
+//
+//The response headers are sent once the subscription is in place, so a client that
+//has received them will be sent every event stored from then on.
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errors.New("Streaming not supported by response writer"))
+		return
+	}
+
+	from, err := intParam(r, "from")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" && from == 0 {
+		last, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil {
+			writeError(w, badRequest("Last-Event-ID: %v", err))
+			return
+		}
+		from = last + 1
+	}
+
+	sub, err := subscription.New(s.store, from)
+	if errors.Is(err, subscription.ErrNotSupported) {
+		err = ErrNotSupported
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		events, ok := sub.Next(r.Context().Done())
+		if !ok {
+			return
+		}
+
+		converted, err := s.wireEvents(events)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+			flusher.Flush()
+			return
+		}
+
+		for _, we := range converted {
+			data, err := json.Marshal(we)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", we.Position, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,174 @@
+//Package httpstore exposes an event store over HTTP with a JSON API, and provides a
+//client implementing the event store interfaces over that API, so services in
+//different processes can share a store.
+//
+//The API has the following endpoints:
+//
+//	POST /streams/{id}   append events to an aggregate
+//	GET  /streams/{id}   read an aggregate's events, optionally a range of versions
+//	POST /batch          append the events of several aggregates atomically
+//	GET  /log            read the global log
+//	GET  /log/head       read the position of the last event in the global log
+//	GET  /subscribe      receive events as they are stored, as Server-Sent Events
+//	POST /republish      republish every stored event to the subscribers
+//
+//Payloads travel as serialized bytes, base64 encoded in the JSON documents. The
+//client encodes and decodes them with its codec, so the server never needs to know
+//the payload types.
+package httpstore
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+var (
+	//ErrNotSupported is returned when the store behind the server does not support
+	//the requested operation.
+	ErrNotSupported = errors.New("Operation not supported by event store")
+
+	//ErrBadRequest is returned when the server rejects a request as malformed.
+	ErrBadRequest = errors.New("Bad request")
+
+	//ErrPayloadNotSerialized is returned when an event payload is not a []byte and
+	//there is no codec to serialize it.
+	ErrPayloadNotSerialized = errors.New("Event payload is not serialized")
+)
+
+//wireEvent is the JSON form of an event.
+type wireEvent struct {
+	AggregateID   string            `json:"aggregateId"`
+	Version       int               `json:"version"`
+	TypeCode      string            `json:"typeCode"`
+	SchemaVersion int               `json:"schemaVersion,omitempty"`
+	Position      int64             `json:"position,omitempty"`
+	EventID       string            `json:"eventId,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+	CausationID   string            `json:"causationId,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Payload       []byte            `json:"payload"`
+}
+
+//appendRequest is the body of a request to append events to an aggregate. Without
+//an expected version the events must follow on from the stored version, as for
+//EventStore.StoreEvents.
+type appendRequest struct {
+	Version         int         `json:"version"`
+	ExpectedVersion *int        `json:"expectedVersion,omitempty"`
+	Events          []wireEvent `json:"events"`
+}
+
+//appendResponse holds the version of the aggregate after an append.
+type appendResponse struct {
+	Version int `json:"version"`
+}
+
+//batchRequest is the body of a request to append the events of several aggregates.
+type batchRequest struct {
+	Aggregates []batchAggregate `json:"aggregates"`
+}
+
+type batchAggregate struct {
+	AggregateID string      `json:"aggregateId"`
+	Version     int         `json:"version"`
+	Events      []wireEvent `json:"events"`
+}
+
+//eventsResponse holds the events read from an aggregate or the global log.
+type eventsResponse struct {
+	Events []wireEvent `json:"events"`
+}
+
+//headResponse holds the position of the last event in the global log.
+type headResponse struct {
+	Position int64 `json:"position"`
+}
+
+//errorResponse is the body of every error response. The concurrency details are set
+//for conflicts.
+type errorResponse struct {
+	Error           string `json:"error"`
+	Code            string `json:"code"`
+	AggregateID     string `json:"aggregateId,omitempty"`
+	ExpectedVersion int    `json:"expectedVersion,omitempty"`
+	ActualVersion   int    `json:"actualVersion,omitempty"`
+}
+
+//errorCodes maps the errors the API reports to their codes and HTTP status codes. The
+//first matching entry is used.
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{goes.ErrConcurrency, "concurrency", http.StatusConflict},
+	{goes.ErrAggregateNotFound, "not_found", http.StatusNotFound},
+	{goes.ErrEventSequence, "event_sequence", http.StatusBadRequest},
+	{goes.ErrDuplicateAggregate, "duplicate_aggregate", http.StatusBadRequest},
+	{goes.ErrUnknownEventType, "unknown_event_type", http.StatusBadRequest},
+	{goes.ErrBatchNotSupported, "batch_not_supported", http.StatusNotImplemented},
+	{ErrNotSupported, "not_supported", http.StatusNotImplemented},
+	{ErrBadRequest, "bad_request", http.StatusBadRequest},
+	{ErrPayloadNotSerialized, "payload_not_serialized", http.StatusInternalServerError},
+}
+
+//remoteError is an error reported by the server. It unwraps to the error its code
+//stands for, so callers can match it with errors.Is.
+type remoteError struct {
+	message string
+	err     error
+}
+
+func (e *remoteError) Error() string {
+	return e.message
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
+
+//toWire converts an event to its JSON form. The payload must already be serialized.
+func toWire(e goes.Event) (wireEvent, error) {
+	payload, ok := e.Payload.([]byte)
+	if !ok && e.Payload != nil {
+		return wireEvent{}, ErrPayloadNotSerialized
+	}
+
+	return wireEvent{
+		AggregateID:   e.Source,
+		Version:       e.Version,
+		TypeCode:      e.TypeCode,
+		SchemaVersion: e.SchemaVersion,
+		Position:      e.Position,
+		EventID:       e.EventID,
+		Timestamp:     e.Timestamp,
+		CorrelationID: e.CorrelationID,
+		CausationID:   e.CausationID,
+		Headers:       e.Headers,
+		Payload:       payload,
+	}, nil
+}
+
+//fromWire converts an event from its JSON form.
+func fromWire(w wireEvent) goes.Event {
+	e := goes.Event{
+		Source:        w.AggregateID,
+		Version:       w.Version,
+		TypeCode:      w.TypeCode,
+		SchemaVersion: w.SchemaVersion,
+		Position:      w.Position,
+		EventID:       w.EventID,
+		Timestamp:     w.Timestamp,
+		CorrelationID: w.CorrelationID,
+		CausationID:   w.CausationID,
+		Headers:       w.Headers,
+	}
+	if w.Payload != nil {
+		e.Payload = w.Payload
+	}
+	return e
+}
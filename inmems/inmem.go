@@ -7,66 +7,341 @@ import (
 	"github.com/xtracdev/goes"
 )
 
-type subscriberStorage struct {
-	subscriberID goes.SubscriptionID
-	callback     goes.EventPublishedCallback
-}
+//catchUpPageSize is the number of events read from the log at a time when
+//replaying history to a catch-up subscriber.
+const catchUpPageSize = 256
+
+var (
+	//ErrSubscriberQueueFull is returned when a write would overflow the queue of a
+	//subscriber using the Error overflow policy.
+	ErrSubscriberQueueFull = errors.New("Subscriber queue full")
+	//ErrStoreClosed is returned when writing to a store that has been closed.
+	ErrStoreClosed = errors.New("Event store closed")
+)
 
+//eventStorage tracks the events for a single aggregate as indexes into the
+//store's global log.
 type eventStorage struct {
-	events         []goes.Event
+	logIndexes     []int
 	currentVersion int
 }
 
-//InMemoryEventStore implements the
+//InMemoryEventStore implements the EventStore, ExpectedVersionStore, BatchStore,
+//EventRangeReader, EventPublisher, EventRepublisher, EventLogReader and CatchUpSubscriber
+//interfaces, holding all events in memory.
+//
+//Events are published asynchronously: each subscriber has its own bounded queue
+//and goroutine, so callbacks run outside the store lock and receive events in
+//commit order.
 type InMemoryEventStore struct {
 	sync.RWMutex
+	config      DeliveryConfig
+	codec       goes.EventCodec
+	upcasters   *goes.UpcasterChain
 	storage     map[string]eventStorage
-	subscribers []subscriberStorage
+	log         []goes.Event
+	subscribers []*subscriber
+	closed      bool
 }
 
 //NewInMemoryEventStore is a factory method for creating InMemoryEventStore
 //instances.
 func NewInMemoryEventStore() *InMemoryEventStore {
+	return NewInMemoryEventStoreWithConfig(DeliveryConfig{})
+}
+
+//NewInMemoryEventStoreWithConfig creates an InMemoryEventStore using the given
+//subscriber delivery configuration. A QueueSize of zero or less uses DefaultQueueSize.
+func NewInMemoryEventStoreWithConfig(config DeliveryConfig) *InMemoryEventStore {
+	if config.QueueSize < 1 {
+		config.QueueSize = DefaultQueueSize
+	}
+
 	return &InMemoryEventStore{
+		config:  config,
 		storage: make(map[string]eventStorage),
 	}
 }
 
-func (im *InMemoryEventStore) publishEvent(event goes.Event) {
+//WithCodec sets a codec used to encode event payloads when they are stored and decode
+//them when they are read or published, so events are held in the serialized form a
+//persistent store would use. It should be set before the store is used.
+func (im *InMemoryEventStore) WithCodec(codec goes.EventCodec) *InMemoryEventStore {
+	im.Lock()
+	defer im.Unlock()
+	im.codec = codec
+	return im
+}
+
+//WithUpcasters sets the upcaster chain applied to stored events when they are read
+//or republished, before they are decoded. It should be set before the store is used.
+func (im *InMemoryEventStore) WithUpcasters(upcasters *goes.UpcasterChain) *InMemoryEventStore {
+	im.Lock()
+	defer im.Unlock()
+	im.upcasters = upcasters
+	return im
+}
+
+//readEvent returns copies of a stored event as they are read by clients: upcast to
+//the current schema and decoded, if the store has upcasters and a codec. Upcasting
+//may split the event into several events, or drop it.
+func (im *InMemoryEventStore) readEvent(e goes.Event) ([]goes.Event, error) {
+	events := []goes.Event{e.Copy()}
+	if im.upcasters != nil {
+		var err error
+		if events, err = im.upcasters.Upcast(events[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	if im.codec == nil {
+		return events, nil
+	}
+	return goes.DecodeEvents(im.codec, events)
+}
+
+//reserveLocked checks every subscriber can accept n events. It returns the
+//subscriber the caller must wait on if a subscriber using the Block policy is
+//full, or an error if a subscriber using the Error policy is full.
+//
+//A write made from a subscriber's callback is not held up by that subscriber's own
+//queue, which only the callback returning can drain; the queue may then briefly hold
+//more events than its capacity.
+func (im *InMemoryEventStore) reserveLocked(n int) (*subscriber, error) {
+	var caller uint64
+	for _, sub := range im.subscribers {
+		if sub.hasRoom(n) {
+			continue
+		}
+
+		if caller == 0 {
+			caller = goroutineID()
+		}
+		if caller != 0 && sub.goroutine == caller {
+			continue
+		}
+
+		switch sub.policy {
+		case Block:
+			return sub, nil
+		case Error:
+			return nil, ErrSubscriberQueueFull
+		}
+	}
+
+	return nil, nil
+}
+
+//whenRoom calls fn with the store lock held once every subscriber can accept n
+//events. Waiting for room happens outside the lock so subscriber callbacks can
+//read from the store while writers are blocked.
+func (im *InMemoryEventStore) whenRoom(n int, fn func() error) error {
+	for {
+		im.Lock()
+		if im.closed {
+			im.Unlock()
+			return ErrStoreClosed
+		}
+
+		waitOn, err := im.reserveLocked(n)
+		if waitOn == nil {
+			if err == nil {
+				err = fn()
+			}
+			im.Unlock()
+			return err
+		}
+		im.Unlock()
+
+		waitOn.waitForRoom(n)
+	}
+}
+
+//publishLocked queues the stored events for delivery to every subscriber. Events
+//that cannot be upcast or decoded are delivered in their stored form.
+func (im *InMemoryEventStore) publishLocked(events []goes.Event) {
+	if len(im.subscribers) == 0 {
+		return
+	}
+
+	decoded := make([]goes.Event, 0, len(events))
+	for _, e := range events {
+		read, err := im.readEvent(e)
+		if err != nil {
+			read = []goes.Event{e}
+		}
+		decoded = append(decoded, read...)
+	}
+
 	for _, sub := range im.subscribers {
-		sub.callback(event)
+		sub.enqueue(decoded)
 	}
 }
 
 //StoreEvents stores the events for the given aggregate in the event
-//store.
+//store, then queues them for delivery to the subscribers. The events must follow on
+//from the version already stored; if the stored aggregate has moved on since the
+//events were produced a ConcurrencyError is returned.
 func (im *InMemoryEventStore) StoreEvents(agg *goes.Aggregate) error {
-	im.Lock()
-	defer im.Unlock()
+	return im.whenRoom(len(agg.Events), func() error {
+		current := im.storage[agg.AggregateID].currentVersion
+		if err := checkVersion(agg, current); err != nil {
+			return err
+		}
 
-	//Do we have events for this aggregate?
-	aggStorage, ok := im.storage[agg.AggregateID]
-	if !ok {
-		aggStorage = eventStorage{}
-	}
+		return im.appendLocked(agg, current)
+	})
+}
 
+//checkVersion returns a ConcurrencyError if the aggregate's events do not follow on from
+//the current stored version.
+func checkVersion(agg *goes.Aggregate, current int) error {
 	//Has someone update the aggregate before the current caller?
-	if !(aggStorage.currentVersion < agg.Version) {
-		return errors.New("Concurrency exception")
+	base := agg.Version - len(agg.Events)
+	if !(current < agg.Version) || base < current {
+		return &goes.ConcurrencyError{
+			AggregateID:     agg.AggregateID,
+			ExpectedVersion: base,
+			ActualVersion:   current,
+		}
 	}
+	return nil
+}
 
-	//Set the new version, and append the events
-	aggStorage.currentVersion = agg.Version
-	for _, e := range agg.Events {
-		aggStorage.events = append(aggStorage.events, e)
-		im.publishEvent(e)
+//StoreBatch stores the events of all the aggregates, or none of them, then queues them
+//for delivery to the subscribers. The events of each aggregate must follow on from the
+//version already stored, as for StoreEvents.
+func (im *InMemoryEventStore) StoreBatch(aggs ...*goes.Aggregate) error {
+	if err := goes.CheckBatch(aggs); err != nil {
+		return err
 	}
 
-	im.storage[agg.AggregateID] = aggStorage
+	var count int
+	for _, agg := range aggs {
+		count += len(agg.Events)
+	}
+
+	return im.whenRoom(count, func() error {
+		//Check and prepare every aggregate before anything is stored
+		prepared := make([][]goes.Event, len(aggs))
+		var offset int
+		for i, agg := range aggs {
+			current := im.storage[agg.AggregateID].currentVersion
+			if err := checkVersion(agg, current); err != nil {
+				return err
+			}
+
+			events, err := im.prepareLocked(agg, current, offset)
+			if err != nil {
+				return err
+			}
+			prepared[i] = events
+			offset += len(events)
+		}
+
+		var stored []goes.Event
+		for i, agg := range aggs {
+			im.commitLocked(agg, prepared[i])
+			stored = append(stored, prepared[i]...)
+		}
+
+		im.publishLocked(stored)
+		return nil
+	})
+}
+
+//StoreEventsExpecting stores the events for the given aggregate if the stored
+//aggregate satisfies the expected version, then queues them for delivery to the
+//subscribers.
+func (im *InMemoryEventStore) StoreEventsExpecting(agg *goes.Aggregate, expected goes.ExpectedVersion) error {
+	return im.whenRoom(len(agg.Events), func() error {
+		current := im.storage[agg.AggregateID].currentVersion
+		if err := expected.Check(agg.AggregateID, current); err != nil {
+			return err
+		}
+
+		//Renumber the events to follow on from whatever is stored, updating the caller's
+		//aggregate only once they have been stored
+		if expected == goes.ExpectAny {
+			renumbered, err := goes.Renumber(agg, current)
+			if err != nil {
+				return err
+			}
+			if err := im.appendLocked(renumbered, current); err != nil {
+				return err
+			}
+
+			for i := range agg.Events {
+				agg.Events[i].Version = renumbered.Events[i].Version
+			}
+			agg.Version = renumbered.Version
+			return nil
+		}
+
+		return im.appendLocked(agg, current)
+	})
+}
+
+//appendLocked appends the aggregate's events to the aggregate stored at the current
+//version.
+func (im *InMemoryEventStore) appendLocked(agg *goes.Aggregate, current int) error {
+	stored, err := im.prepareLocked(agg, current, 0)
+	if err != nil || len(stored) == 0 {
+		return err
+	}
+
+	im.commitLocked(agg, stored)
+	im.publishLocked(stored)
 
 	return nil
 }
 
+//prepareLocked validates the aggregate's events against the current stored version, and
+//returns them in the form they are stored. The events are positioned in the global log
+//after offset other events about to be appended.
+func (im *InMemoryEventStore) prepareLocked(agg *goes.Aggregate, current int, offset int) ([]goes.Event, error) {
+	if err := goes.ValidateEventSequence(agg, current+1); err != nil {
+		return nil, err
+	}
+
+	//Fill in any metadata the aggregate did not supply, and assign each event
+	//the next position in the global log
+	stored := make([]goes.Event, 0, len(agg.Events))
+	for i, e := range agg.Events {
+		event := e.Copy()
+		if err := event.InitMetadata(); err != nil {
+			return nil, err
+		}
+		if im.codec != nil {
+			var err error
+			if event, err = im.codec.EncodeEvent(event); err != nil {
+				return nil, err
+			}
+		}
+		event.Position = int64(len(im.log) + offset + i + 1)
+		stored = append(stored, event)
+	}
+
+	return stored, nil
+}
+
+//commitLocked appends the prepared events to the log, and sets the aggregate's stored
+//version.
+func (im *InMemoryEventStore) commitLocked(agg *goes.Aggregate, stored []goes.Event) {
+	if len(stored) == 0 {
+		return
+	}
+
+	aggStorage := im.storage[agg.AggregateID]
+	aggStorage.currentVersion = agg.Version
+	for _, e := range stored {
+		aggStorage.logIndexes = append(aggStorage.logIndexes, len(im.log))
+		im.log = append(im.log, e)
+	}
+
+	im.storage[agg.AggregateID] = aggStorage
+}
+
 //RetrieveEvents retrieves the events in the event store assocaited with the given
 //aggregate id.
 func (im *InMemoryEventStore) RetrieveEvents(aggregateID string) ([]goes.Event, error) {
@@ -75,10 +350,92 @@ func (im *InMemoryEventStore) RetrieveEvents(aggregateID string) ([]goes.Event,
 
 	eventStorage, ok := im.storage[aggregateID]
 	if !ok {
-		return nil, errors.New("No events stored for aggregate")
+		return nil, goes.ErrAggregateNotFound
 	}
 
-	return eventStorage.events, nil
+	events := make([]goes.Event, 0, len(eventStorage.logIndexes))
+	for _, idx := range eventStorage.logIndexes {
+		read, err := im.readEvent(im.log[idx])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, read...)
+	}
+
+	return events, nil
+}
+
+//RetrieveEventRange retrieves the range of events for the given aggregate id selected
+//by the query. The range is selected using the stored event versions; events split by
+//upcasting are returned whole, so the result may exceed MaxEvents.
+func (im *InMemoryEventStore) RetrieveEventRange(aggregateID string, query goes.RangeQuery) ([]goes.Event, error) {
+	im.RLock()
+	defer im.RUnlock()
+
+	eventStorage, ok := im.storage[aggregateID]
+	if !ok {
+		return nil, goes.ErrAggregateNotFound
+	}
+
+	indexes := eventStorage.logIndexes
+	var events []goes.Event
+	for i := range indexes {
+		idx := indexes[i]
+		if query.Backward {
+			idx = indexes[len(indexes)-1-i]
+		}
+
+		if !query.Includes(im.log[idx].Version) {
+			continue
+		}
+
+		read, err := im.readEvent(im.log[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, read...)
+		if query.MaxEvents > 0 && len(events) >= query.MaxEvents {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+//ReadEventLog reads up to maxEvents events from the global log, starting at
+//fromPosition. Events dropped by upcasting are skipped over, so an empty result always
+//means the end of the log has been reached; events split by upcasting share the
+//position of the stored event and are returned whole.
+func (im *InMemoryEventStore) ReadEventLog(fromPosition int64, maxEvents int) ([]goes.Event, error) {
+	im.RLock()
+	defer im.RUnlock()
+
+	if fromPosition < 1 {
+		fromPosition = 1
+	}
+
+	var events []goes.Event
+	for i := int(fromPosition - 1); i < len(im.log); i++ {
+		if maxEvents > 0 && len(events) >= maxEvents {
+			break
+		}
+
+		read, err := im.readEvent(im.log[i])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, read...)
+	}
+
+	return events, nil
+}
+
+//HeadPosition returns the position of the last event written to the global log.
+func (im *InMemoryEventStore) HeadPosition() (int64, error) {
+	im.RLock()
+	defer im.RUnlock()
+	return int64(len(im.log)), nil
 }
 
 //SubscribeEvents registers the provided callback as an event subscriber.
@@ -87,34 +444,135 @@ func (im *InMemoryEventStore) SubscribeEvents(callback goes.EventPublishedCallba
 	defer im.Unlock()
 	id, _ := goes.GenerateID()
 	subscriptionID := goes.SubscriptionID(id)
-	im.subscribers = append(im.subscribers, subscriberStorage{subscriberID: subscriptionID, callback: callback})
+	if !im.closed {
+		im.subscribers = append(im.subscribers, newSubscriber(subscriptionID, callback, im.config, nil))
+	}
 	return subscriptionID
 
 }
 
+//SubscribeFrom replays the events stored from fromPosition onwards to the provided
+//callback, then registers the callback as a subscriber to live events. The bulk of
+//the history is replayed without blocking writers; the final catch up and the
+//registration happen under the store lock so no event is missed or delivered twice.
+func (im *InMemoryEventStore) SubscribeFrom(fromPosition int64, callback goes.EventPublishedCallback) (goes.SubscriptionID, error) {
+	if fromPosition < 1 {
+		fromPosition = 1
+	}
+
+	for {
+		page, err := im.ReadEventLog(fromPosition, catchUpPageSize)
+		if err != nil {
+			return "", err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, e := range page {
+			callback(e)
+		}
+		fromPosition = page[len(page)-1].Position + 1
+	}
+
+	im.Lock()
+	defer im.Unlock()
+
+	if im.closed {
+		return "", ErrStoreClosed
+	}
+
+	id, err := goes.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	//Anything stored since the last page was read is queued ahead of the live
+	//events the subscriber will receive from here on
+	var backlog []goes.Event
+	for i := int(fromPosition - 1); i < len(im.log); i++ {
+		read, err := im.readEvent(im.log[i])
+		if err != nil {
+			return "", err
+		}
+		backlog = append(backlog, read...)
+	}
+
+	subscriptionID := goes.SubscriptionID(id)
+	im.subscribers = append(im.subscribers, newSubscriber(subscriptionID, callback, im.config, backlog))
+	return subscriptionID, nil
+}
+
 //Unsubscribe removes the event subscription associated with the provided
-//subscription id.
+//subscription id. Events queued for the subscriber that have not yet been
+//delivered are discarded.
 func (im *InMemoryEventStore) Unsubscribe(subscriptionID goes.SubscriptionID) {
 	im.Lock()
-	remainingSubs := make([]subscriberStorage, 0, len(im.subscribers)-1)
+	remainingSubs := make([]*subscriber, 0, len(im.subscribers))
 	for _, sub := range im.subscribers {
-		if sub.subscriberID != subscriptionID {
+		if sub.id != subscriptionID {
 			remainingSubs = append(remainingSubs, sub)
+		} else {
+			sub.cancel()
 		}
 	}
 	im.subscribers = remainingSubs
 	im.Unlock()
 }
 
-//RepublishAllEvents republishers events to subscribers.
+//RepublishAllEvents republishes events to subscribers in the order they were
+//committed to the store. The log is queued a page at a time, so events stored
+//while republishing is in progress may be interleaved with the republished events.
 func (im *InMemoryEventStore) RepublishAllEvents() error {
-	im.Lock()
-	defer im.Unlock()
+	var position int64 = 1
+	for {
+		page, err := im.ReadEventLog(position, im.config.QueueSize)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
 
-	for _, aggEvents := range im.storage {
-		for _, e := range aggEvents.events {
-			im.publishEvent(e)
+		//The page has already been upcast and decoded, so is queued as it is
+		err = im.whenRoom(len(page), func() error {
+			for _, sub := range im.subscribers {
+				sub.enqueue(page)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+
+		position = page[len(page)-1].Position + 1
+	}
+}
+
+//Drain blocks until every event published so far has been delivered to the
+//subscribers. It must not be called from a subscriber callback.
+func (im *InMemoryEventStore) Drain() {
+	im.RLock()
+	subs := append([]*subscriber(nil), im.subscribers...)
+	im.RUnlock()
+
+	for _, sub := range subs {
+		sub.drain()
+	}
+}
+
+//Close stops the store accepting writes, delivers any events still queued for
+//the subscribers, then stops the subscriber goroutines. It must not be called
+//from a subscriber callback.
+func (im *InMemoryEventStore) Close() error {
+	im.Lock()
+	im.closed = true
+	subs := im.subscribers
+	im.subscribers = nil
+	im.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
 	}
 
 	return nil
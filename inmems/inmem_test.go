@@ -0,0 +1,106 @@
+package inmemes_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) goes.EventStore {
+		return inmemes.NewInMemoryEventStore()
+	})
+}
+
+func TestConformanceWithCodec(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) goes.EventStore {
+		return inmemes.NewInMemoryEventStore().WithCodec(storetest.Codecs)
+	})
+}
+
+func TestConformanceWithSmallQueues(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) goes.EventStore {
+		return inmemes.NewInMemoryEventStoreWithConfig(inmemes.DeliveryConfig{QueueSize: 1})
+	})
+}
+
+//countingCodec counts the events it decodes.
+type countingCodec struct {
+	goes.EventCodec
+	decoded int64
+}
+
+func (c *countingCodec) DecodeEvent(e goes.Event) (goes.Event, error) {
+	atomic.AddInt64(&c.decoded, 1)
+	return c.EventCodec.DecodeEvent(e)
+}
+
+func TestRepublishDecodesOnce(t *testing.T) {
+	codec := &countingCodec{EventCodec: storetest.Codecs}
+	store := inmemes.NewInMemoryEventStore().WithCodec(codec)
+	defer store.Close()
+
+	agg, err := goes.NewAggregate()
+	assert.Nil(t, err)
+	agg.Version = 1
+	agg.Events = []goes.Event{{Source: agg.AggregateID, Version: 1, TypeCode: storetest.TestEventTypeCode,
+		Payload: storetest.TestEvent{Name: "one"}}}
+	assert.Nil(t, store.StoreEvents(agg))
+
+	var received []goes.Event
+	store.SubscribeEvents(func(e goes.Event) { received = append(received, e) })
+	atomic.StoreInt64(&codec.decoded, 0)
+	assert.Nil(t, store.RepublishAllEvents())
+	store.Drain()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&codec.decoded))
+	if assert.Equal(t, 1, len(received)) {
+		assert.Equal(t, storetest.TestEvent{Name: "one"}, received[0].Payload)
+	}
+}
+
+func TestRepublishWithFreshUpcastEvents(t *testing.T) {
+	upcasters := goes.NewUpcasterChain()
+	upcasters.Register(storetest.TestEventTypeCode, 0, func(e goes.Event) ([]goes.Event, error) {
+		return []goes.Event{{TypeCode: storetest.TestEventTypeCode, SchemaVersion: 1, Payload: e.Payload}}, nil
+	})
+	store := inmemes.NewInMemoryEventStoreWithConfig(inmemes.DeliveryConfig{QueueSize: 1}).WithUpcasters(upcasters)
+	defer store.Close()
+
+	for _, name := range []string{"one", "two"} {
+		agg, err := goes.NewAggregate()
+		assert.Nil(t, err)
+		agg.Version = 1
+		agg.Events = []goes.Event{{Source: agg.AggregateID, Version: 1, TypeCode: storetest.TestEventTypeCode,
+			Payload: storetest.TestEvent{Name: name}}}
+		assert.Nil(t, store.StoreEvents(agg))
+	}
+
+	var positions []int64
+	store.SubscribeEvents(func(e goes.Event) { positions = append(positions, e.Position) })
+	assert.Nil(t, store.RepublishAllEvents())
+	store.Drain()
+	assert.Equal(t, []int64{1, 2}, positions)
+}
+
+func TestFailedExpectAnyLeavesAggregate(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(storetest.Codecs)
+	defer store.Close()
+
+	stored := &goes.Aggregate{AggregateID: "agg", Version: 1, Events: []goes.Event{
+		{Source: "agg", Version: 1, TypeCode: storetest.TestEventTypeCode, Payload: storetest.TestEvent{Name: "one"}},
+	}}
+	assert.Nil(t, store.StoreEvents(stored))
+
+	//The payload has no codec registered, so the events cannot be stored
+	agg := &goes.Aggregate{AggregateID: "agg", Version: 1, Events: []goes.Event{
+		{Source: "agg", Version: 1, TypeCode: "UNKNOWN", Payload: struct{ Name string }{"two"}},
+	}}
+	assert.NotNil(t, store.StoreEventsExpecting(agg, goes.ExpectAny))
+	assert.Equal(t, 1, agg.Version)
+	assert.Equal(t, 1, agg.Events[0].Version)
+}
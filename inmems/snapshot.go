@@ -0,0 +1,53 @@
+package inmemes
+
+import (
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//InMemorySnapshotStore implements the SnapshotStore interface, retaining the
+//latest snapshot for each aggregate in memory.
+type InMemorySnapshotStore struct {
+	sync.RWMutex
+	snapshots map[string]goes.Snapshot
+}
+
+//NewInMemorySnapshotStore is a factory method for creating InMemorySnapshotStore
+//instances.
+func NewInMemorySnapshotStore() *InMemorySnapshotStore {
+	return &InMemorySnapshotStore{
+		snapshots: make(map[string]goes.Snapshot),
+	}
+}
+
+//SaveSnapshot saves the snapshot, replacing any older snapshot for the same
+//aggregate. A snapshot older than the one already held is ignored.
+func (ss *InMemorySnapshotStore) SaveSnapshot(snapshot goes.Snapshot) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if current, ok := ss.snapshots[snapshot.AggregateID]; ok && current.Version >= snapshot.Version {
+		return nil
+	}
+
+	snapshot.State = append([]byte(nil), snapshot.State...)
+	ss.snapshots[snapshot.AggregateID] = snapshot
+
+	return nil
+}
+
+//LoadSnapshot returns the latest snapshot for the aggregate, or nil if no snapshot
+//has been saved.
+func (ss *InMemorySnapshotStore) LoadSnapshot(aggregateID string) (*goes.Snapshot, error) {
+	ss.RLock()
+	defer ss.RUnlock()
+
+	snapshot, ok := ss.snapshots[aggregateID]
+	if !ok {
+		return nil, nil
+	}
+
+	snapshot.State = append([]byte(nil), snapshot.State...)
+	return &snapshot, nil
+}
@@ -0,0 +1,183 @@
+package inmemes
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//OverflowPolicy determines what happens when an event is published to a
+//subscriber whose delivery queue is full.
+type OverflowPolicy int
+
+const (
+	//Block makes the writer wait until the subscriber has room for the events.
+	Block OverflowPolicy = iota
+	//DropOldest discards the oldest undelivered events to make room.
+	DropOldest
+	//Error rejects the write with ErrSubscriberQueueFull before anything is stored.
+	Error
+)
+
+//DefaultQueueSize is the per subscriber queue size used when none is configured.
+const DefaultQueueSize = 1024
+
+//DeliveryConfig configures how events are delivered to subscribers.
+type DeliveryConfig struct {
+	QueueSize int
+	Overflow  OverflowPolicy
+}
+
+//subscriber delivers events to a single callback from its own goroutine, in the
+//order the events were queued.
+type subscriber struct {
+	id       goes.SubscriptionID
+	callback goes.EventPublishedCallback
+	capacity int
+	policy   OverflowPolicy
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	queue     []goes.Event
+	busy      bool
+	closed    bool
+	done      chan struct{}
+	goroutine uint64
+}
+
+func newSubscriber(id goes.SubscriptionID, callback goes.EventPublishedCallback, config DeliveryConfig, backlog []goes.Event) *subscriber {
+	sub := &subscriber{
+		id:       id,
+		callback: callback,
+		capacity: config.QueueSize,
+		policy:   config.Overflow,
+		queue:    backlog,
+		done:     make(chan struct{}),
+	}
+	sub.cond = sync.NewCond(&sub.mu)
+
+	started := make(chan struct{})
+	go func() {
+		sub.goroutine = goroutineID()
+		close(started)
+		sub.run()
+	}()
+	<-started
+
+	return sub
+}
+
+//goroutineID returns the id of the calling goroutine, read from its stack trace. It is
+//only used to recognise writes made by a subscriber callback.
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
+}
+
+//hasRoomLocked reports whether n events can be queued without overflowing. An
+//empty queue always accepts a batch, even one larger than the queue capacity, so
+//large batches cannot wait forever.
+func (s *subscriber) hasRoomLocked(n int) bool {
+	return s.closed || len(s.queue) == 0 || len(s.queue)+n <= s.capacity
+}
+
+func (s *subscriber) hasRoom(n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hasRoomLocked(n)
+}
+
+//waitForRoom blocks until n events can be queued without overflowing.
+func (s *subscriber) waitForRoom(n int) {
+	s.mu.Lock()
+	for !s.hasRoomLocked(n) {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+}
+
+func (s *subscriber) enqueue(events []goes.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	for _, e := range events {
+		s.queue = append(s.queue, e.Copy())
+	}
+
+	if s.policy == DropOldest && len(s.queue) > s.capacity {
+		s.queue = append([]goes.Event(nil), s.queue[len(s.queue)-s.capacity:]...)
+	}
+
+	s.cond.Broadcast()
+}
+
+func (s *subscriber) run() {
+	defer close(s.done)
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.busy = true
+		s.mu.Unlock()
+
+		s.callback(event)
+
+		s.mu.Lock()
+		s.busy = false
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+//drain blocks until every queued event has been delivered.
+func (s *subscriber) drain() {
+	s.mu.Lock()
+	for len(s.queue) > 0 || s.busy {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+}
+
+//close stops the subscriber after the queued events have been delivered, and
+//waits for its goroutine to exit.
+func (s *subscriber) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	<-s.done
+}
+
+//cancel stops the subscriber, discarding any undelivered events. It does not
+//wait for an in flight callback, so it is safe to call from the callback itself.
+func (s *subscriber) cancel() {
+	s.mu.Lock()
+	s.closed = true
+	s.queue = nil
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/httpstore"
 	"github.com/xtracdev/goes/inmems"
 	"github.com/xtracdev/goes/sample"
 	"log"
@@ -60,5 +61,8 @@ func benchHandler(rw http.ResponseWriter, req *http.Request) {
 func main() {
 	http.HandleFunc("/bench", benchHandler)
 	http.HandleFunc("/stats", statsHandler)
+
+	//The benchmark events can be read back through the event store API
+	http.Handle("/", httpstore.NewServer(eventStore).WithCodec(sample.Codecs))
 	http.ListenAndServe(":8080", nil)
 }
@@ -50,4 +50,25 @@ func init() {
 		assert.Equal(T, 2, userFromHistory.Version)
 	})
 
+	Given(`^an event sourced aggregate's event history with an unknown event$`, func() {
+		eventHistory = []goes.Event{
+			goes.Event{
+				Payload: sample.UserCreated{
+					AggregateId: "123",
+				},
+			},
+			goes.Event{
+				Payload: "not a user event",
+			},
+		}
+	})
+
+	When(`^I try to instantiate the aggregate from its history$`, func() {
+		userFromHistory = sample.NewUserFromHistory(eventHistory)
+	})
+
+	Then(`^the aggregate cannot be instantiated$`, func() {
+		assert.Nil(T, userFromHistory)
+	})
+
 }
@@ -14,3 +14,8 @@ Feature: Event Sourced Aggregate
         Then the instance state is correct
         And there are no uncommitted events
         And the aggregate version is correct
+
+    Scenario: Aggregate from event history with an unknown event
+        Given an event sourced aggregate's event history with an unknown event
+        When I try to instantiate the aggregate from its history
+        Then the aggregate cannot be instantiated
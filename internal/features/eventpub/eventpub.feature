@@ -19,4 +19,37 @@ Feature: Event Publishing
     Scenario:
         Given a populated event store
         When republish all events is called
-        Then the events store events are republished
\ No newline at end of file
+        Then the events store events are republished
+    Scenario: Catch-up subscriptions replay history then receive live events
+        Given an event store with stored history
+        When a catch-up subscription is made while events are being stored
+        Then the subscriber receives every event once in log order
+        And other subscribers do not receive the replayed history
+
+    Scenario: Slow subscribers do not block writers
+        Given an event store with a slow subscriber
+        When events are stored
+        Then the writer is not blocked by the subscriber
+        And the subscriber eventually receives the events in order
+
+    Scenario: Subscriber callbacks can read from the event store
+        Given an event store with a subscriber that reads the event store
+        When events are stored
+        Then the subscriber is able to retrieve the stored events
+
+    Scenario: Full subscriber queues can drop the oldest events
+        Given an event store that drops the oldest events for full subscriber queues
+        When more events are stored than a blocked subscriber can queue
+        Then the subscriber receives only the newest events
+
+    Scenario: Full subscriber queues can reject writes
+        Given an event store that rejects writes when a subscriber queue is full
+        When more events are stored than a blocked subscriber can queue
+        Then the write is rejected with a queue full error
+
+    Scenario: Closing the event store delivers queued events
+        Given an event store with a slow subscriber
+        When events are stored
+        And the event store is closed
+        Then the subscriber eventually receives the events in order
+        And the closed event store rejects writes
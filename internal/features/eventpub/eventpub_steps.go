@@ -1,6 +1,9 @@
 package eventpub
 
 import (
+	"sync"
+	"time"
+
 	. "github.com/gucumber/gucumber"
 	"github.com/stretchr/testify/assert"
 	"github.com/xtracdev/goes"
@@ -34,12 +37,14 @@ func init() {
 	})
 
 	Then(`^all the events are published$`, func() {
+		inMemEventStore.Drain()
 		assert.Equal(T, 2, len(events))
 	})
 
 	Then(`^no events are published$`, func() {
 		eventHistory, _ := eventStore.RetrieveEvents(user.AggregateID)
 		sample.NewUserFromHistory(eventHistory)
+		inMemEventStore.Drain()
 		assert.Equal(T, 2, len(events))
 	})
 
@@ -53,6 +58,7 @@ func init() {
 	Then(`^previously subscribed callback is not invoked when events are published$`, func() {
 		user, _ = sample.NewUser("first", "last", "email")
 		user.Store(eventStore)
+		inMemEventStore.Drain()
 		assert.Equal(T, 2, len(events))
 	})
 
@@ -65,7 +71,197 @@ func init() {
 	})
 
 	Then(`^the events store events are republished$`, func() {
+		inMemEventStore.Drain()
 		assert.Equal(T, 3, len(republishedEvents))
 	})
 
+	var catchUpStore *inmemes.InMemoryEventStore
+	var catchUpEvents, otherSubEvents []goes.Event
+	var catchUpLock sync.Mutex
+
+	Given(`^an event store with stored history$`, func() {
+		catchUpStore = inmemes.NewInMemoryEventStore()
+		catchUpEvents, otherSubEvents = nil, nil
+		for i := 0; i < 10; i++ {
+			u, _ := sample.NewUser("first", "last", "email")
+			u.UpdateFirstName("new first")
+			assert.Nil(T, u.Store(catchUpStore))
+		}
+
+		catchUpStore.SubscribeEvents(func(e goes.Event) {
+			otherSubEvents = append(otherSubEvents, e)
+		})
+	})
+
+	When(`^a catch-up subscription is made while events are being stored$`, func() {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				u, _ := sample.NewUser("first", "last", "email")
+				u.Store(catchUpStore)
+			}
+		}()
+
+		_, err := catchUpStore.SubscribeFrom(1, func(e goes.Event) {
+			catchUpLock.Lock()
+			catchUpEvents = append(catchUpEvents, e)
+			catchUpLock.Unlock()
+		})
+		assert.Nil(T, err)
+		wg.Wait()
+		catchUpStore.Drain()
+	})
+
+	Then(`^the subscriber receives every event once in log order$`, func() {
+		catchUpLock.Lock()
+		defer catchUpLock.Unlock()
+		if assert.Equal(T, 70, len(catchUpEvents)) {
+			for i, e := range catchUpEvents {
+				assert.Equal(T, int64(i+1), e.Position)
+			}
+		}
+	})
+
+	And(`^other subscribers do not receive the replayed history$`, func() {
+		assert.Equal(T, 50, len(otherSubEvents))
+	})
+
+	var asyncStore *inmemes.InMemoryEventStore
+	var asyncEvents []goes.Event
+	var asyncErrs []error
+	var asyncLock sync.Mutex
+	var storeDuration time.Duration
+	var gate, started chan struct{}
+
+	recordAsync := func(e goes.Event, err error) {
+		asyncLock.Lock()
+		asyncEvents = append(asyncEvents, e)
+		if err != nil {
+			asyncErrs = append(asyncErrs, err)
+		}
+		asyncLock.Unlock()
+	}
+
+	gatedSubscriber := func(policy inmemes.OverflowPolicy) {
+		asyncStore = inmemes.NewInMemoryEventStoreWithConfig(inmemes.DeliveryConfig{
+			QueueSize: 2,
+			Overflow:  policy,
+		})
+		asyncEvents, asyncErrs = nil, nil
+		gate, started = make(chan struct{}), make(chan struct{})
+		first := true
+		asyncStore.SubscribeEvents(func(e goes.Event) {
+			if first {
+				first = false
+				close(started)
+				<-gate
+			}
+			recordAsync(e, nil)
+		})
+	}
+
+	Given(`^an event store with a slow subscriber$`, func() {
+		asyncStore = inmemes.NewInMemoryEventStore()
+		asyncEvents, asyncErrs = nil, nil
+		asyncStore.SubscribeEvents(func(e goes.Event) {
+			time.Sleep(50 * time.Millisecond)
+			recordAsync(e, nil)
+		})
+	})
+
+	Given(`^an event store with a subscriber that reads the event store$`, func() {
+		asyncStore = inmemes.NewInMemoryEventStore()
+		asyncEvents, asyncErrs = nil, nil
+		asyncStore.SubscribeEvents(func(e goes.Event) {
+			_, err := asyncStore.RetrieveEvents(e.Source)
+			recordAsync(e, err)
+		})
+	})
+
+	When(`^events are stored$`, func() {
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			u, _ := sample.NewUser("first", "last", "email")
+			u.UpdateFirstName("new first")
+			assert.Nil(T, u.Store(asyncStore))
+		}
+		storeDuration = time.Since(start)
+	})
+
+	Then(`^the writer is not blocked by the subscriber$`, func() {
+		assert.True(T, storeDuration < 150*time.Millisecond, "Writer blocked for %v", storeDuration)
+	})
+
+	And(`^the subscriber eventually receives the events in order$`, func() {
+		asyncStore.Drain()
+		asyncLock.Lock()
+		defer asyncLock.Unlock()
+		if assert.Equal(T, 6, len(asyncEvents)) {
+			for i, e := range asyncEvents {
+				assert.Equal(T, int64(i+1), e.Position)
+			}
+		}
+	})
+
+	Then(`^the subscriber is able to retrieve the stored events$`, func() {
+		asyncStore.Drain()
+		asyncLock.Lock()
+		defer asyncLock.Unlock()
+		assert.Equal(T, 6, len(asyncEvents))
+		assert.Equal(T, 0, len(asyncErrs))
+	})
+
+	Given(`^an event store that drops the oldest events for full subscriber queues$`, func() {
+		gatedSubscriber(inmemes.DropOldest)
+	})
+
+	Given(`^an event store that rejects writes when a subscriber queue is full$`, func() {
+		gatedSubscriber(inmemes.Error)
+	})
+
+	When(`^more events are stored than a blocked subscriber can queue$`, func() {
+		for i := 0; i < 5; i++ {
+			u, _ := sample.NewUser("first", "last", "email")
+			if err := u.Store(asyncStore); err != nil {
+				asyncErrs = append(asyncErrs, err)
+			}
+			if i == 0 {
+				<-started
+			}
+		}
+	})
+
+	Then(`^the subscriber receives only the newest events$`, func() {
+		close(gate)
+		asyncStore.Drain()
+		asyncLock.Lock()
+		defer asyncLock.Unlock()
+		if assert.Equal(T, 3, len(asyncEvents)) {
+			assert.Equal(T, int64(1), asyncEvents[0].Position)
+			assert.Equal(T, int64(4), asyncEvents[1].Position)
+			assert.Equal(T, int64(5), asyncEvents[2].Position)
+		}
+	})
+
+	Then(`^the write is rejected with a queue full error$`, func() {
+		if assert.Equal(T, 2, len(asyncErrs)) {
+			assert.Equal(T, inmemes.ErrSubscriberQueueFull, asyncErrs[0])
+		}
+		close(gate)
+		asyncStore.Drain()
+		head, _ := asyncStore.HeadPosition()
+		assert.Equal(T, int64(3), head)
+	})
+
+	And(`^the event store is closed$`, func() {
+		assert.Nil(T, asyncStore.Close())
+	})
+
+	And(`^the closed event store rejects writes$`, func() {
+		u, _ := sample.NewUser("first", "last", "email")
+		assert.Equal(T, inmemes.ErrStoreClosed, u.Store(asyncStore))
+	})
+
 }
@@ -25,4 +25,51 @@ Feature: Event Store
     Scenario: Concurrency exceptions can occur if an aggregate is modified concurrently
         Given an aggregate
         When it is modified by two concurrent threads of control
-        Then the second thread that stored the aggregate gets a concurrency error
\ No newline at end of file
+        Then the second thread that stored the aggregate gets a concurrency error
+    Scenario: Event metadata is retained by the event store
+        Given an aggregate
+        And an event store
+        When the events are stored
+        Then the retrieved events carry the event metadata
+
+    Scenario: Events can be read from the global log in commit order
+        Given aggregates stored in an event store in sequence
+        When the global event log is read in pages
+        Then the events are returned in commit order with increasing positions
+
+    Scenario: A range of an aggregate's events can be retrieved
+        Given an aggregate with 10 stored events
+        When the events from version 3 to version 5 are retrieved
+        Then events 3 to 5 are returned in order
+        And the latest 2 events can be read backwards
+
+    Scenario: Retrieving events for an unknown aggregate
+        Given an event store
+        Then retrieving the events for an unknown aggregate returns an aggregate not found error
+
+    Scenario: Storing events for an aggregate that must not exist yet
+        Given an aggregate
+        And an event store
+        When the events are stored expecting no stream
+        Then storing the events again expecting no stream gets a concurrency error
+
+    Scenario: Storing events at an exact expected version
+        Given an aggregate stored in an event store
+        When a new event is stored expecting the stored version
+        Then storing another event expecting the old version gets a concurrency error
+
+    Scenario: Appending events regardless of the stored version
+        Given an aggregate stored in an event store
+        And a stale copy of the aggregate with a new event
+        When the stale events are stored expecting any version
+        Then the stale events are appended after the stored events
+
+    Scenario: Events with gaps in their versions are rejected
+        Given an aggregate stored in an event store
+        When events are stored with a gap in their versions
+        Then an event sequence error is returned
+
+    Scenario: Events written with an old schema are upcast when read
+        Given an event store with upcasters for the legacy name change event
+        When a legacy name change event is stored
+        Then the event is read back as first and last name updates
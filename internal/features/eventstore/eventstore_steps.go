@@ -1,6 +1,9 @@
 package eventstore
 
 import (
+	"encoding/json"
+	"errors"
+
 	. "github.com/gucumber/gucumber"
 	"github.com/stretchr/testify/assert"
 	"github.com/xtracdev/goes"
@@ -107,7 +110,17 @@ func init() {
 		err := u1.Store(eventStore)
 		assert.Nil(T, err)
 		err = u2.Store(eventStore)
-		assert.NotNil(T, err)
+		assert.True(T, errors.Is(err, goes.ErrConcurrency))
+
+		var concurrencyErr *goes.ConcurrencyError
+		if assert.True(T, errors.As(err, &concurrencyErr)) {
+			assert.Equal(T, user.AggregateID, concurrencyErr.AggregateID)
+		}
+	})
+
+	Then(`^retrieving the events for an unknown aggregate returns an aggregate not found error$`, func() {
+		_, err := eventStore.RetrieveEvents("no-such-aggregate")
+		assert.True(T, errors.Is(err, goes.ErrAggregateNotFound))
 	})
 
 	And(`^all the events in the event history have the aggregate id as their source$`, func() {
@@ -118,4 +131,226 @@ func init() {
 		}
 	})
 
+	Then(`^the retrieved events carry the event metadata$`, func() {
+		events, err := eventStore.RetrieveEvents(user.AggregateID)
+		assert.Nil(T, err)
+		if assert.Equal(T, 1, len(events)) {
+			assert.NotEmpty(T, events[0].EventID)
+			assert.NotEmpty(T, events[0].CorrelationID)
+			assert.False(T, events[0].Timestamp.IsZero())
+		}
+	})
+
+	var logStore *inmemes.InMemoryEventStore
+	var logUsers []*sample.User
+	var logEvents []goes.Event
+
+	Given(`^aggregates stored in an event store in sequence$`, func() {
+		logStore = inmemes.NewInMemoryEventStore()
+		logUsers = nil
+		for i := 0; i < 3; i++ {
+			u, err := sample.NewUser("first", "last", "email")
+			assert.Nil(T, err)
+			u.UpdateFirstName("new first")
+			assert.Nil(T, u.Store(logStore))
+			logUsers = append(logUsers, u)
+		}
+	})
+
+	When(`^the global event log is read in pages$`, func() {
+		logEvents = nil
+		var reader goes.EventLogReader = logStore
+		var position int64 = 1
+		for {
+			page, err := reader.ReadEventLog(position, 4)
+			assert.Nil(T, err)
+			if len(page) == 0 {
+				break
+			}
+			logEvents = append(logEvents, page...)
+			position = page[len(page)-1].Position + 1
+		}
+	})
+
+	Then(`^the events are returned in commit order with increasing positions$`, func() {
+		if assert.Equal(T, 6, len(logEvents)) {
+			for i, e := range logEvents {
+				assert.Equal(T, int64(i+1), e.Position)
+				assert.Equal(T, logUsers[i/2].AggregateID, e.Source)
+			}
+		}
+
+		head, err := logStore.HeadPosition()
+		assert.Nil(T, err)
+		assert.Equal(T, int64(6), head)
+	})
+
+	var rangeStore *inmemes.InMemoryEventStore
+	var rangeUser *sample.User
+	var rangeEvents []goes.Event
+
+	Given(`^an aggregate with (\d+) stored events$`, func(count int) {
+		rangeStore = inmemes.NewInMemoryEventStore()
+		rangeUser, _ = sample.NewUser("first", "last", "email")
+		for i := 1; i < count; i++ {
+			rangeUser.UpdateFirstName("new first")
+		}
+		assert.Nil(T, rangeUser.Store(rangeStore))
+	})
+
+	When(`^the events from version (\d+) to version (\d+) are retrieved$`, func(from, to int) {
+		var err error
+		rangeEvents, err = rangeStore.RetrieveEventRange(rangeUser.AggregateID, goes.RangeQuery{
+			FromVersion: from,
+			ToVersion:   to,
+		})
+		assert.Nil(T, err)
+	})
+
+	Then(`^events (\d+) to (\d+) are returned in order$`, func(from, to int) {
+		if assert.Equal(T, to-from+1, len(rangeEvents)) {
+			for i, e := range rangeEvents {
+				assert.Equal(T, from+i, e.Version)
+			}
+		}
+	})
+
+	And(`^the latest (\d+) events can be read backwards$`, func(count int) {
+		events, err := rangeStore.RetrieveEventRange(rangeUser.AggregateID, goes.RangeQuery{
+			Backward:  true,
+			MaxEvents: count,
+		})
+		assert.Nil(T, err)
+		if assert.Equal(T, count, len(events)) {
+			for i, e := range events {
+				assert.Equal(T, rangeUser.Version-i, e.Version)
+			}
+		}
+	})
+
+	var evStore *inmemes.InMemoryEventStore
+	var evUser, staleUser *sample.User
+	var evErr error
+
+	When(`^the events are stored expecting no stream$`, func() {
+		evStore = inmemes.NewInMemoryEventStore()
+		evUser = user
+		assert.Nil(T, evStore.StoreEventsExpecting(evUser.Aggregate, goes.ExpectNoStream))
+	})
+
+	Then(`^storing the events again expecting no stream gets a concurrency error$`, func() {
+		err := evStore.StoreEventsExpecting(evUser.Aggregate, goes.ExpectNoStream)
+		assert.True(T, errors.Is(err, goes.ErrConcurrency))
+	})
+
+	Given(`^an aggregate stored in an event store$`, func() {
+		evStore = inmemes.NewInMemoryEventStore()
+		evUser, _ = sample.NewUser("first", "last", "email")
+		evUser.UpdateFirstName("new first")
+		assert.Nil(T, evUser.Store(evStore))
+	})
+
+	When(`^a new event is stored expecting the stored version$`, func() {
+		stored := evUser.Version
+		evUser.UpdateFirstName("newer first")
+		assert.Nil(T, evStore.StoreEventsExpecting(evUser.Aggregate, goes.ExpectVersion(stored)))
+		evUser.Events = nil
+	})
+
+	Then(`^storing another event expecting the old version gets a concurrency error$`, func() {
+		evUser.UpdateFirstName("newest first")
+		err := evStore.StoreEventsExpecting(evUser.Aggregate, goes.ExpectVersion(evUser.Version-2))
+
+		var concurrencyErr *goes.ConcurrencyError
+		if assert.True(T, errors.As(err, &concurrencyErr)) {
+			assert.Equal(T, evUser.Version-2, concurrencyErr.ExpectedVersion)
+			assert.Equal(T, evUser.Version-1, concurrencyErr.ActualVersion)
+		}
+	})
+
+	And(`^a stale copy of the aggregate with a new event$`, func() {
+		events, err := evStore.RetrieveEvents(evUser.AggregateID)
+		assert.Nil(T, err)
+		staleUser = sample.NewUserFromHistory(events[:1])
+		staleUser.AggregateID = evUser.AggregateID
+		staleUser.UpdateFirstName("stale first")
+	})
+
+	When(`^the stale events are stored expecting any version$`, func() {
+		assert.Nil(T, evStore.StoreEventsExpecting(staleUser.Aggregate, goes.ExpectAny))
+	})
+
+	Then(`^the stale events are appended after the stored events$`, func() {
+		assert.Equal(T, 3, staleUser.Version)
+		events, err := evStore.RetrieveEvents(evUser.AggregateID)
+		assert.Nil(T, err)
+		if assert.Equal(T, 3, len(events)) {
+			assert.Equal(T, 3, events[2].Version)
+			assert.Equal(T, "stale first", events[2].Payload.(sample.UserFirstNameUpdated).NewFirst)
+		}
+	})
+
+	When(`^events are stored with a gap in their versions$`, func() {
+		evUser.Version += 2
+		evUser.UpdateFirstName("gap first")
+		evErr = evStore.StoreEventsExpecting(evUser.Aggregate, goes.ExpectVersion(2))
+	})
+
+	Then(`^an event sequence error is returned$`, func() {
+		assert.True(T, errors.Is(evErr, goes.ErrEventSequence))
+	})
+
+	var upcastStore *inmemes.InMemoryEventStore
+	var legacyUser *sample.User
+
+	Given(`^an event store with upcasters for the legacy name change event$`, func() {
+		//The legacy event changed both names at once; it is now two separate events
+		upcasters := goes.NewUpcasterChain()
+		upcasters.Register("UNAME", 0, func(e goes.Event) ([]goes.Event, error) {
+			var legacy struct{ First, Last string }
+			if err := json.Unmarshal(e.Payload.([]byte), &legacy); err != nil {
+				return nil, err
+			}
+
+			first, last := e, e
+			first.TypeCode = sample.UserFirstNameUpdatedTypeCode
+			first.Payload, _ = json.Marshal(sample.UserFirstNameUpdated{NewFirst: legacy.First})
+			last.TypeCode = sample.UserLastNameUpdatedTypeCode
+			last.Payload, _ = json.Marshal(sample.UserLastNameUpdated{NewLast: legacy.Last})
+			return []goes.Event{first, last}, nil
+		})
+
+		upcastStore = inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs).WithUpcasters(upcasters)
+	})
+
+	When(`^a legacy name change event is stored$`, func() {
+		var err error
+		legacyUser, err = sample.NewUser("first", "last", "email")
+		assert.Nil(T, err)
+		legacyUser.Version++
+		legacyUser.Events = append(legacyUser.Events, goes.Event{
+			Source:   legacyUser.AggregateID,
+			Version:  legacyUser.Version,
+			TypeCode: "UNAME",
+			Payload:  []byte(`{"First":"new first","Last":"new last"}`),
+		})
+		assert.Nil(T, upcastStore.StoreEvents(legacyUser.Aggregate))
+	})
+
+	Then(`^the event is read back as first and last name updates$`, func() {
+		events, err := upcastStore.RetrieveEvents(legacyUser.AggregateID)
+		assert.Nil(T, err)
+		if assert.Equal(T, 3, len(events)) {
+			assert.Equal(T, sample.UserFirstNameUpdated{NewFirst: "new first"}, events[1].Payload)
+			assert.Equal(T, sample.UserLastNameUpdated{NewLast: "new last"}, events[2].Payload)
+			assert.Equal(T, 2, events[2].Version)
+		}
+
+		user, err := sample.NewUserRepository(upcastStore).Load(legacyUser.AggregateID)
+		if assert.Nil(T, err) {
+			assert.Equal(T, "new first", user.FirstName)
+			assert.Equal(T, "new last", user.LastName)
+		}
+	})
+
 }
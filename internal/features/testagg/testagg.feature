@@ -16,3 +16,17 @@ Feature: TestAgg Event Store
     And the TestAgg aggregate version is correct when built from event history
     And all the events in the Test event history have the aggregate id as their source
 
+
+  Scenario: TestAgg state can be restored from a snapshot
+    Given a TestAgg aggregate
+    And an event store and snapshot store for TestAgg
+    When foo is updated and stored 7 times with a snapshot every 3 events
+    Then a snapshot of the TestAgg aggregate at version 6 has been saved
+    And the TestAgg aggregate loaded using the snapshot has the latest state
+
+  Scenario: TestAgg events are serialized by the event store codec
+    Given a TestAgg aggregate
+    And an event store that serializes events with the TestAgg codecs
+    When the TestAgg events are stored
+    Then the events for the TestAgg aggregate are decoded when retrieved
+    And events the TestAgg codecs do not know cannot be stored
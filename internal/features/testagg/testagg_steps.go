@@ -1,6 +1,9 @@
 package testagg
 
 import (
+	"errors"
+	"fmt"
+
 	. "github.com/gucumber/gucumber"
 	"github.com/xtracdev/goes/sample/testagg"
 
@@ -74,4 +77,67 @@ func init() {
 		}
 	})
 
+	var snapshotStore *inmemes.InMemorySnapshotStore
+
+	And(`^an event store and snapshot store for TestAgg$`, func() {
+		eventStore = inmemes.NewInMemoryEventStore()
+		snapshotStore = inmemes.NewInMemorySnapshotStore()
+	})
+
+	When(`^foo is updated and stored (\d+) times with a snapshot every (\d+) events$`, func(updates, every int) {
+		policy := goes.EveryNEvents(every)
+		assert.Nil(T, ta.StoreWithSnapshot(eventStore, snapshotStore, policy))
+		for i := 0; i < updates; i++ {
+			ta.UpdateFoo(fmt.Sprintf("foo %d", i))
+			assert.Nil(T, ta.StoreWithSnapshot(eventStore, snapshotStore, policy))
+		}
+	})
+
+	Then(`^a snapshot of the TestAgg aggregate at version (\d+) has been saved$`, func(version int) {
+		snapshot, err := snapshotStore.LoadSnapshot(ta.AggregateID)
+		assert.Nil(T, err)
+		if assert.NotNil(T, snapshot) {
+			assert.Equal(T, version, snapshot.Version)
+		}
+	})
+
+	And(`^the TestAgg aggregate loaded using the snapshot has the latest state$`, func() {
+		loaded, err := testagg.LoadTestAgg(eventStore, snapshotStore, ta.AggregateID)
+		assert.Nil(T, err)
+		if assert.NotNil(T, loaded) {
+			assert.Equal(T, ta.AggregateID, loaded.AggregateID)
+			assert.Equal(T, ta.Version, loaded.Version)
+			assert.Equal(T, ta.Foo, loaded.Foo)
+			assert.Equal(T, "b", loaded.Bar)
+			assert.Equal(T, "b", loaded.Baz)
+		}
+	})
+
+	var codecStore *inmemes.InMemoryEventStore
+
+	And(`^an event store that serializes events with the TestAgg codecs$`, func() {
+		codecStore = inmemes.NewInMemoryEventStore().WithCodec(testagg.Codecs)
+		eventStore = codecStore
+	})
+
+	And(`^the events for the TestAgg aggregate are decoded when retrieved$`, func() {
+		events, err := codecStore.RetrieveEvents(ta.AggregateID)
+		assert.Nil(T, err)
+		if assert.Equal(T, 1, len(events)) {
+			created, ok := events[0].Payload.(testagg.TestAggCreated)
+			if assert.True(T, ok) {
+				assert.Equal(T, "f", created.Foo)
+			}
+		}
+	})
+
+	And(`^events the TestAgg codecs do not know cannot be stored$`, func() {
+		err := codecStore.StoreEvents(&goes.Aggregate{
+			AggregateID: "unknown",
+			Version:     1,
+			Events:      []goes.Event{{Source: "unknown", Version: 1, Payload: "not a TestAgg event"}},
+		})
+		assert.True(T, errors.Is(err, goes.ErrUnknownEventType))
+	})
+
 }
@@ -0,0 +1,118 @@
+package subscription
+
+import (
+	"context"
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//Remote is a subscription a client holds open to a store served by the HTTP or gRPC
+//server.
+type Remote struct {
+	sync.Mutex
+	cancel context.CancelFunc
+	ended  bool
+	done   chan struct{}
+}
+
+//Ended reports whether the subscription has ended. Clients stop delivering events to
+//the callback once it has.
+func (r *Remote) Ended() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.ended
+}
+
+//Remotes keeps track of the subscriptions held open by a client, and the last error
+//that ended one.
+type Remotes struct {
+	sync.Mutex
+	subscriptions map[goes.SubscriptionID]*Remote
+	err           error
+}
+
+//NewRemotes creates an empty Remotes.
+func NewRemotes() *Remotes {
+	return &Remotes{subscriptions: make(map[goes.SubscriptionID]*Remote)}
+}
+
+//Add records a subscription whose connection is closed by cancel, returning its ID.
+//If no ID can be generated the connection is closed and the error returned.
+func (r *Remotes) Add(cancel context.CancelFunc) (goes.SubscriptionID, *Remote, error) {
+	id, err := goes.GenerateID()
+	if err != nil {
+		cancel()
+		return "", nil, err
+	}
+
+	remote := &Remote{cancel: cancel, done: make(chan struct{})}
+	r.Lock()
+	r.subscriptions[goes.SubscriptionID(id)] = remote
+	r.Unlock()
+	return goes.SubscriptionID(id), remote, nil
+}
+
+//End ends the subscription and closes its connection, recording err as the error
+//reported by Err if it is not nil. Ending a subscription that has already ended does
+//nothing.
+func (r *Remotes) End(subscriptionID goes.SubscriptionID, err error) {
+	r.Lock()
+	remote, ok := r.subscriptions[subscriptionID]
+	delete(r.subscriptions, subscriptionID)
+	if ok && err != nil {
+		r.err = err
+	}
+	r.Unlock()
+
+	if !ok {
+		return
+	}
+
+	remote.Lock()
+	remote.ended = true
+	remote.Unlock()
+	remote.cancel()
+	close(remote.done)
+}
+
+//Done returns a channel that is closed once the subscription ends.
+func (r *Remotes) Done(subscriptionID goes.SubscriptionID) <-chan struct{} {
+	r.Lock()
+	defer r.Unlock()
+	if remote, ok := r.subscriptions[subscriptionID]; ok {
+		return remote.done
+	}
+
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+//Close ends every subscription.
+func (r *Remotes) Close() {
+	r.Lock()
+	ids := make([]goes.SubscriptionID, 0, len(r.subscriptions))
+	for id := range r.subscriptions {
+		ids = append(ids, id)
+	}
+	r.Unlock()
+
+	for _, id := range ids {
+		r.End(id, nil)
+	}
+}
+
+//SetErr records an error to be reported by Err.
+func (r *Remotes) SetErr(err error) {
+	r.Lock()
+	r.err = err
+	r.Unlock()
+}
+
+//Err returns the last error recorded.
+func (r *Remotes) Err() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.err
+}
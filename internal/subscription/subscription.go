@@ -0,0 +1,116 @@
+//Package subscription streams the events published by an event store to a remote
+//subscriber, as the HTTP and gRPC servers do. A subscription can replay the stored
+//events from a log position before switching to live events, with no gaps or
+//duplicates between the two, and buffers the events published to it so the store is
+//never held up by a slow connection.
+//
+//Remotes does the bookkeeping for the other end: the subscriptions the HTTP and gRPC
+//clients hold open, and how each of them ended.
+package subscription
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//ErrNotSupported is returned when the store does not publish events, or cannot replay
+//stored events when asked to.
+var ErrNotSupported = errors.New("Operation not supported by event store")
+
+//Subscription is a subscription to the events published by a store.
+type Subscription struct {
+	sync.Mutex
+	publisher  goes.EventPublisher
+	id         goes.SubscriptionID
+	events     []goes.Event
+	ready      chan struct{}
+	replay     []goes.Event
+	replayedTo int64
+}
+
+//New subscribes to the events published by the store. If from is above zero the
+//events stored from that position onwards are returned first; this needs a store
+//implementing goes.CatchUpSubscriber or goes.EventLogReader. Once New returns, every
+//event stored from then on is delivered by the subscription.
+func New(store goes.EventStore, from int64) (*Subscription, error) {
+	publisher, ok := store.(goes.EventPublisher)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	s := &Subscription{publisher: publisher, ready: make(chan struct{}, 1)}
+	if catchUp, ok := store.(goes.CatchUpSubscriber); ok && from > 0 {
+		var err error
+		if s.id, err = catchUp.SubscribeFrom(from, s.push); err != nil {
+			return nil, err
+		}
+	} else if logReader, ok := store.(goes.EventLogReader); ok && from > 0 {
+		//Subscribe before reading the log, and skip the live events already replayed
+		s.id = publisher.SubscribeEvents(s.push)
+		replay, err := logReader.ReadEventLog(from, 0)
+		if err != nil {
+			publisher.Unsubscribe(s.id)
+			return nil, err
+		}
+		s.replay, s.replayedTo = replay, from-1
+		if len(replay) > 0 {
+			s.replayedTo = replay[len(replay)-1].Position
+		}
+	} else if from > 0 {
+		return nil, ErrNotSupported
+	} else {
+		s.id = publisher.SubscribeEvents(s.push)
+	}
+
+	return s, nil
+}
+
+//push is the subscription callback, queueing the event.
+func (s *Subscription) push(e goes.Event) {
+	s.Lock()
+	s.events = append(s.events, e)
+	s.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+//Next waits for events and returns them in log order, or returns false once done is
+//closed.
+func (s *Subscription) Next(done <-chan struct{}) ([]goes.Event, bool) {
+	if replay := s.replay; replay != nil {
+		s.replay = nil
+		return replay, true
+	}
+
+	for {
+		s.Lock()
+		events := s.events
+		s.events = nil
+		s.Unlock()
+
+		//The events read from the log are returned whole, so every event at or before
+		//the last position replayed has already been returned
+		for len(events) > 0 && events[0].Position <= s.replayedTo {
+			events = events[1:]
+		}
+		if len(events) > 0 {
+			return events, true
+		}
+
+		select {
+		case <-done:
+			return nil, false
+		case <-s.ready:
+		}
+	}
+}
+
+//Close unsubscribes from the store. Events queued but not yet returned are discarded.
+func (s *Subscription) Close() {
+	s.publisher.Unsubscribe(s.id)
+}
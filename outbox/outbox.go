@@ -0,0 +1,121 @@
+//Package outbox relays stored events to external systems, such as message brokers,
+//with at least once delivery.
+//
+//Publishing to subscribers happens as events are stored, so an event published while a
+//bridge to a broker is down is never delivered to it. Instead, an Outbox holds the
+//stored events that are still pending delivery, and a Relay delivers them to a Sink in
+//order, retrying with backoff until the sink confirms delivery, before marking each one
+//as dispatched.
+package outbox
+
+import (
+	"sync"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/projection"
+)
+
+//Sink delivers events to an external system. Send returns once delivery of the event
+//has been confirmed. An event may be sent more than once, so receivers should use the
+//event ID to discard duplicates.
+type Sink interface {
+	Send(event goes.Event) error
+}
+
+//SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(event goes.Event) error
+
+//Send calls the function.
+func (f SinkFunc) Send(event goes.Event) error {
+	return f(event)
+}
+
+//Outbox holds the stored events that have not yet been dispatched.
+type Outbox interface {
+	//Pending returns up to max of the events waiting to be dispatched, in the order
+	//they were stored.
+	Pending(max int) ([]goes.Event, error)
+	//MarkDispatched records that the event, and every event stored before it, has
+	//been dispatched.
+	MarkDispatched(event goes.Event) error
+}
+
+//LogOutbox implements the Outbox interface over a store's global log. Every event in
+//the log after the last event dispatched is pending; the position of the last event
+//dispatched is kept in a checkpoint store under the outbox's name.
+//
+//Events split from one stored event by upcasting share its log position. The checkpoint
+//is only moved past a position once every event split from it has been dispatched; the
+//outbox remembers the events dispatched at a position it has not moved past, and leaves
+//them out of Pending, until it is recreated.
+type LogOutbox struct {
+	sync.Mutex
+	name        string
+	reader      goes.EventLogReader
+	checkpoints projection.CheckpointStore
+
+	//parts counts the events at each position returned by the last call to Pending
+	parts map[int64]int
+	//dispatched counts the events dispatched at position, which the checkpoint has not
+	//moved past
+	position   int64
+	dispatched int
+}
+
+//NewLogOutbox creates an outbox for the events in the store's log, keeping its
+//position under the given name in the checkpoint store.
+func NewLogOutbox(name string, reader goes.EventLogReader, checkpoints projection.CheckpointStore) *LogOutbox {
+	return &LogOutbox{
+		name:        name,
+		reader:      reader,
+		checkpoints: checkpoints,
+	}
+}
+
+//Pending returns up to max of the events stored after the last event dispatched.
+func (o *LogOutbox) Pending(max int) ([]goes.Event, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	checkpoint, err := o.checkpoints.LoadCheckpoint(o.name)
+	if err != nil {
+		return nil, err
+	}
+	events, err := o.reader.ReadEventLog(checkpoint+1, max)
+	if err != nil {
+		return nil, err
+	}
+
+	o.parts = make(map[int64]int)
+	for _, e := range events {
+		o.parts[e.Position]++
+	}
+
+	//Leave out the events already dispatched at the first position
+	if o.position != checkpoint+1 {
+		o.position, o.dispatched = 0, 0
+	}
+	skip := 0
+	for skip < len(events) && skip < o.dispatched && events[skip].Position == o.position {
+		skip++
+	}
+	return events[skip:], nil
+}
+
+//MarkDispatched records the event's position as the last dispatched, once every event
+//at that position returned by Pending has been dispatched.
+func (o *LogOutbox) MarkDispatched(event goes.Event) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if event.Position != o.position {
+		o.position, o.dispatched = event.Position, 0
+	}
+	o.dispatched++
+	if o.dispatched < o.parts[event.Position] {
+		return nil
+	}
+
+	o.position, o.dispatched = 0, 0
+	return o.checkpoints.SaveCheckpoint(o.name, event.Position)
+}
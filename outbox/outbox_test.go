@@ -0,0 +1,298 @@
+package outbox_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/outbox"
+	"github.com/xtracdev/goes/projection"
+	"github.com/xtracdev/goes/sample"
+)
+
+func storeUser(t *testing.T, store goes.EventStore, first string) *sample.User {
+	user, err := sample.NewUser(first, "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+	return user
+}
+
+func noWait(int) time.Duration {
+	return time.Millisecond
+}
+
+func TestRelayDeliversPendingEvents(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	checkpoints := projection.NewInMemoryCheckpointStore()
+	box := outbox.NewLogOutbox("broker", store, checkpoints)
+	sink := new(outbox.MemorySink)
+	relay := outbox.NewRelay(box, sink).WithBatchSize(2)
+
+	storeUser(t, store, "one")
+	storeUser(t, store, "two")
+	storeUser(t, store, "three")
+
+	delivered, err := relay.DeliverPending()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, delivered)
+
+	var positions []int64
+	for _, e := range sink.Events() {
+		positions = append(positions, e.Position)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, positions)
+
+	pending, err := box.Pending(0)
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+
+	//A new relay over the same checkpoints only delivers events stored since
+	storeUser(t, store, "four")
+	delivered, err = outbox.NewRelay(outbox.NewLogOutbox("broker", store, checkpoints), sink).DeliverPending()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, sink.Events(), 4)
+}
+
+func TestRelayRetriesFailedDelivery(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	box := outbox.NewLogOutbox("broker", store, projection.NewInMemoryCheckpointStore())
+
+	storeUser(t, store, "one")
+	storeUser(t, store, "two")
+
+	down := errors.New("broker down")
+	var attempts int
+	sink := new(outbox.MemorySink)
+	flaky := outbox.SinkFunc(func(e goes.Event) error {
+		attempts++
+		if e.Position == 2 && attempts < 6 {
+			return down
+		}
+		return sink.Send(e)
+	})
+
+	relay := outbox.NewRelay(box, flaky).WithRetries(3, noWait)
+
+	//The second event fails every attempt in the first pass, and stays pending
+	delivered, err := relay.DeliverPending()
+	assert.Equal(t, down, err)
+	assert.Equal(t, 1, delivered)
+
+	pending, err := box.Pending(0)
+	assert.Nil(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, int64(2), pending[0].Position)
+	}
+
+	delivered, err = relay.DeliverPending()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, sink.Events(), 2)
+}
+
+func TestRelayDeliversEverySplitEvent(t *testing.T) {
+	upcasters := goes.NewUpcasterChain()
+	upcasters.Register("GREETED_AND_WAVED", 0, func(e goes.Event) ([]goes.Event, error) {
+		return []goes.Event{{TypeCode: "GREETED"}, {TypeCode: "WAVED"}}, nil
+	})
+	store := inmemes.NewInMemoryEventStore().WithUpcasters(upcasters)
+	checkpoints := projection.NewInMemoryCheckpointStore()
+	box := outbox.NewLogOutbox("broker", store, checkpoints)
+
+	for i := 0; i < 2; i++ {
+		agg, err := goes.NewAggregate()
+		assert.Nil(t, err)
+		agg.Version = 1
+		agg.Events = []goes.Event{{Source: agg.AggregateID, Version: 1, TypeCode: "GREETED_AND_WAVED"}}
+		assert.Nil(t, store.StoreEvents(agg))
+	}
+
+	down := errors.New("broker down")
+	fail := true
+	sink := new(outbox.MemorySink)
+	flaky := outbox.SinkFunc(func(e goes.Event) error {
+		if fail && e.Position == 2 && e.TypeCode == "WAVED" {
+			return down
+		}
+		return sink.Send(e)
+	})
+	relay := outbox.NewRelay(box, flaky).WithRetries(1, noWait)
+
+	//The second event split from the second stored event fails, so its position is not
+	//dispatched
+	delivered, err := relay.DeliverPending()
+	assert.Equal(t, down, err)
+	assert.Equal(t, 3, delivered)
+	checkpoint, err := checkpoints.LoadCheckpoint("broker")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), checkpoint)
+
+	fail = false
+	delivered, err = relay.DeliverPending()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+
+	var typeCodes []string
+	for _, e := range sink.Events() {
+		typeCodes = append(typeCodes, e.TypeCode)
+	}
+	assert.Equal(t, []string{"GREETED", "WAVED", "GREETED", "WAVED"}, typeCodes)
+	checkpoint, err = checkpoints.LoadCheckpoint("broker")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), checkpoint)
+}
+
+func TestRelayDeliversToHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var failures int
+	received := make(map[string]sample.UserCreated)
+
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		//Fail the first two deliveries, as a broker would while restarting
+		if failures < 2 {
+			failures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var event struct {
+			Payload sample.UserCreated
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received[r.Header.Get("Idempotency-Key")] = event.Payload
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer broker.Close()
+
+	store := inmemes.NewInMemoryEventStore()
+	user := storeUser(t, store, "one")
+
+	relay := outbox.NewRelay(
+		outbox.NewLogOutbox("broker", store, projection.NewInMemoryCheckpointStore()),
+		outbox.NewHTTPSink(broker.URL, nil),
+	).WithRetries(3, noWait)
+
+	delivered, err := relay.DeliverPending()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+
+	events, err := store.RetrieveEvents(user.AggregateID)
+	assert.Nil(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Contains(t, received, events[0].EventID) {
+		assert.Equal(t, "one", received[events[0].EventID].FirstName)
+	}
+}
+
+func TestRelayRunsInBackground(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	sink := new(outbox.MemorySink)
+	relay := outbox.NewRelay(outbox.NewLogOutbox("broker", store, projection.NewInMemoryCheckpointStore()), sink)
+
+	relay.Run(5 * time.Millisecond)
+	storeUser(t, store, "one")
+
+	assert.Eventually(t, func() bool {
+		return len(sink.Events()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	relay.Stop()
+	assert.Nil(t, relay.Err())
+}
+
+func TestRelayRunsWithDefaultInterval(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	sink := new(outbox.MemorySink)
+	relay := outbox.NewRelay(outbox.NewLogOutbox("broker", store, projection.NewInMemoryCheckpointStore()), sink)
+
+	storeUser(t, store, "one")
+	relay.Run(0)
+	assert.Eventually(t, func() bool {
+		return len(sink.Events()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	relay.Stop()
+	assert.Nil(t, relay.Err())
+}
+
+func TestRelayRunsAgainAfterStop(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	sink := new(outbox.MemorySink)
+	relay := outbox.NewRelay(outbox.NewLogOutbox("broker", store, projection.NewInMemoryCheckpointStore()), sink)
+
+	relay.Run(5 * time.Millisecond)
+	relay.Stop()
+
+	relay.Run(5 * time.Millisecond)
+	storeUser(t, store, "one")
+	assert.Eventually(t, func() bool {
+		return len(sink.Events()) == 1
+	}, time.Second, 5*time.Millisecond)
+	relay.Stop()
+	relay.Stop()
+}
+
+func TestRelayRunsOneLoop(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	var mu sync.Mutex
+	var sending, maxSending, sent int
+	sink := outbox.SinkFunc(func(goes.Event) error {
+		mu.Lock()
+		sending++
+		if sending > maxSending {
+			maxSending = sending
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		sending--
+		sent++
+		mu.Unlock()
+		return nil
+	})
+	relay := outbox.NewRelay(outbox.NewLogOutbox("broker", store, projection.NewInMemoryCheckpointStore()), sink)
+
+	for i := 0; i < 10; i++ {
+		storeUser(t, store, "one")
+	}
+	relay.Run(time.Millisecond)
+	relay.Run(time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent >= 10
+	}, time.Second, 5*time.Millisecond)
+	relay.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 10, sent)
+	assert.Equal(t, 1, maxSending)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := outbox.ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, backoff(1))
+	assert.Equal(t, 20*time.Millisecond, backoff(2))
+	assert.Equal(t, 40*time.Millisecond, backoff(3))
+	assert.Equal(t, 50*time.Millisecond, backoff(4))
+}
@@ -0,0 +1,205 @@
+package outbox
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//DefaultBatchSize is the number of pending events read at a time when no batch size is
+//configured.
+const DefaultBatchSize = 100
+
+//DefaultMaxAttempts is the number of times delivery of an event is attempted in a pass
+//when no limit is configured.
+const DefaultMaxAttempts = 5
+
+//DefaultInterval is how often a running relay checks the outbox for new events when no
+//interval is given.
+const DefaultInterval = time.Second
+
+//ErrRelayStopped is returned when the relay is stopped while retrying a delivery.
+var ErrRelayStopped = errors.New("Relay stopped")
+
+//Backoff returns how long to wait before the given retry of a delivery, counting from 1.
+type Backoff func(retry int) time.Duration
+
+//ExponentialBackoff returns a backoff that waits initial before the first retry, doubling
+//the wait for each further retry up to max.
+func ExponentialBackoff(initial, max time.Duration) Backoff {
+	return func(retry int) time.Duration {
+		wait := initial
+		for i := 1; i < retry && wait < max; i++ {
+			wait *= 2
+		}
+		if wait > max {
+			wait = max
+		}
+		return wait
+	}
+}
+
+//Relay delivers the events pending in an outbox to a sink, in order. An event is marked
+//as dispatched only once the sink confirms delivery, and events after a failed delivery
+//are held back until it succeeds, so every event is delivered at least once and in the
+//order it was stored.
+type Relay struct {
+	sync.Mutex
+	outbox      Outbox
+	sink        Sink
+	batchSize   int
+	maxAttempts int
+	backoff     Backoff
+	err         error
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+//NewRelay creates a relay delivering the events in the outbox to the sink.
+func NewRelay(outbox Outbox, sink Sink) *Relay {
+	return &Relay{
+		outbox:      outbox,
+		sink:        sink,
+		batchSize:   DefaultBatchSize,
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     ExponentialBackoff(100*time.Millisecond, 10*time.Second),
+	}
+}
+
+//WithBatchSize sets the number of pending events read at a time.
+func (r *Relay) WithBatchSize(batchSize int) *Relay {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	r.batchSize = batchSize
+	return r
+}
+
+//WithRetries sets the number of times delivery of an event is attempted in a pass, and
+//the backoff between attempts.
+func (r *Relay) WithRetries(maxAttempts int, backoff Backoff) *Relay {
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	r.maxAttempts = maxAttempts
+	r.backoff = backoff
+	return r
+}
+
+//DeliverPending delivers the events pending in the outbox until none are left, and
+//returns the number delivered. If an event still cannot be delivered after the maximum
+//number of attempts, the error is returned and the event remains pending.
+func (r *Relay) DeliverPending() (int, error) {
+	r.Lock()
+	stop := r.stop
+	r.Unlock()
+	return r.deliverPending(stop)
+}
+
+//deliverPending delivers the events pending in the outbox, giving up retrying a delivery
+//if stop is closed.
+func (r *Relay) deliverPending(stop <-chan struct{}) (int, error) {
+	var delivered int
+	for {
+		pending, err := r.outbox.Pending(r.batchSize)
+		if err != nil {
+			return delivered, err
+		}
+		if len(pending) == 0 {
+			return delivered, nil
+		}
+
+		for _, event := range pending {
+			if err := r.deliver(stop, func() error { return r.sink.Send(event) }); err != nil {
+				return delivered, err
+			}
+			if err := r.outbox.MarkDispatched(event); err != nil {
+				return delivered, err
+			}
+			delivered++
+		}
+	}
+}
+
+//deliver calls send until it succeeds or the maximum number of attempts is reached,
+//waiting between attempts.
+func (r *Relay) deliver(stop <-chan struct{}, send func() error) error {
+	err := send()
+	for retry := 1; err != nil && retry < r.maxAttempts; retry++ {
+		select {
+		case <-stop:
+			return ErrRelayStopped
+		case <-time.After(r.backoff(retry)):
+		}
+		err = send()
+	}
+	return err
+}
+
+//Run delivers pending events in the background, checking the outbox for new events at
+//the given interval until the relay is stopped. An interval of zero or less uses
+//DefaultInterval. Delivery errors are reported by Err. Run does nothing if the relay is
+//already running; a stopped relay can be run again.
+func (r *Relay) Run(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	r.Lock()
+	if r.done != nil {
+		r.Unlock()
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	r.stop, r.done = stop, done
+	r.Unlock()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			_, err := r.deliverPending(stop)
+			r.Lock()
+			r.err = err
+			r.Unlock()
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+//Stop stops the relay, waiting for a background delivery pass to finish.
+func (r *Relay) Stop() {
+	r.Lock()
+	stop, done := r.stop, r.done
+	if stop != nil {
+		close(stop)
+		r.stop = nil
+	}
+	r.Unlock()
+
+	if done == nil {
+		return
+	}
+	<-done
+
+	r.Lock()
+	if r.done == done {
+		r.done = nil
+	}
+	r.Unlock()
+}
+
+//Err returns the error from the last background delivery pass, if it failed.
+func (r *Relay) Err() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.err
+}
@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//MemorySink is an in process sink recording the events sent to it, for tests and for
+//relaying events within a process.
+type MemorySink struct {
+	sync.Mutex
+	events []goes.Event
+}
+
+//Send records the event.
+func (s *MemorySink) Send(event goes.Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, event.Copy())
+	return nil
+}
+
+//Events returns the events sent to the sink.
+func (s *MemorySink) Events() []goes.Event {
+	s.Lock()
+	defer s.Unlock()
+	return append([]goes.Event(nil), s.events...)
+}
+
+//HTTPSink delivers each event as a JSON document posted to a URL. Delivery is confirmed
+//by a 2xx response. The event ID is sent in the Idempotency-Key header, so the receiver
+//can discard events delivered more than once.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+//NewHTTPSink creates a sink posting events to the URL with the client, or with
+//http.DefaultClient if client is nil.
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSink{url: url, client: client}
+}
+
+//Send posts the event to the sink's URL.
+func (s *HTTPSink) Send(event goes.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.EventID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Delivering event %s to %s: %s", event.EventID, s.url, resp.Status)
+	}
+	return nil
+}
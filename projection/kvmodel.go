@@ -0,0 +1,79 @@
+package projection
+
+import (
+	"sort"
+	"sync"
+)
+
+//KeyValueModel is an in memory read model holding values of type V by key. It is safe
+//for concurrent use, so queries can read it while a projection updates it.
+type KeyValueModel[V any] struct {
+	sync.RWMutex
+	items map[string]V
+}
+
+//NewKeyValueModel creates an empty KeyValueModel.
+func NewKeyValueModel[V any]() *KeyValueModel[V] {
+	return &KeyValueModel[V]{
+		items: make(map[string]V),
+	}
+}
+
+//Get returns the value held for the key, and whether there is one.
+func (m *KeyValueModel[V]) Get(key string) (V, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	value, ok := m.items[key]
+	return value, ok
+}
+
+//Put sets the value held for the key.
+func (m *KeyValueModel[V]) Put(key string, value V) {
+	m.Lock()
+	defer m.Unlock()
+	m.items[key] = value
+}
+
+//Update replaces the value held for the key with the value returned by update, which
+//is given the current value and whether there is one.
+func (m *KeyValueModel[V]) Update(key string, update func(current V, exists bool) V) {
+	m.Lock()
+	defer m.Unlock()
+	current, ok := m.items[key]
+	m.items[key] = update(current, ok)
+}
+
+//Delete removes the value held for the key.
+func (m *KeyValueModel[V]) Delete(key string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.items, key)
+}
+
+//Keys returns the keys in the model, sorted.
+func (m *KeyValueModel[V]) Keys() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	keys := make([]string, 0, len(m.items))
+	for key := range m.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Len returns the number of values in the model.
+func (m *KeyValueModel[V]) Len() int {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.items)
+}
+
+//Reset removes every value from the model.
+func (m *KeyValueModel[V]) Reset() error {
+	m.Lock()
+	defer m.Unlock()
+	m.items = make(map[string]V)
+	return nil
+}
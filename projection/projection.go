@@ -0,0 +1,81 @@
+//Package projection builds read models from the events published by an event store.
+//
+//A Projection handles events, usually dispatching them by type code with Handlers. A
+//Runner feeds a projection the events from a store's global log or its subscription,
+//recording how far the projection has got in a CheckpointStore so it resumes where it
+//left off, and rebuilds the projection from scratch by replaying the store's log.
+package projection
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//ErrNotResettable is returned when rebuilding a projection that does not implement
+//Resetter.
+var ErrNotResettable = errors.New("Projection cannot be reset")
+
+//Projection builds a read model from events. The name identifies the projection's
+//checkpoint, so must be unique and stable.
+type Projection interface {
+	Name() string
+	Handle(event goes.Event) error
+}
+
+//Resetter is implemented by projections that can discard their read model, so it can
+//be rebuilt from the start of the event log.
+type Resetter interface {
+	Reset() error
+}
+
+//Handlers maps event type codes to the functions handling them. Events with type codes
+//that have no handler are ignored, so a projection handles just the events it needs.
+type Handlers map[string]func(goes.Event) error
+
+//Handle calls the handler for the event's type code, if there is one.
+func (h Handlers) Handle(event goes.Event) error {
+	if handler, ok := h[event.TypeCode]; ok {
+		return handler(event)
+	}
+	return nil
+}
+
+//CheckpointStore records the log position of the last event each projection handled.
+type CheckpointStore interface {
+	//LoadCheckpoint returns the checkpoint for the named projection, or zero if none
+	//has been saved.
+	LoadCheckpoint(name string) (int64, error)
+	SaveCheckpoint(name string, position int64) error
+}
+
+//InMemoryCheckpointStore implements the CheckpointStore interface, holding the
+//checkpoints in memory.
+type InMemoryCheckpointStore struct {
+	sync.RWMutex
+	checkpoints map[string]int64
+}
+
+//NewInMemoryCheckpointStore is a factory method for creating InMemoryCheckpointStore
+//instances.
+func NewInMemoryCheckpointStore() *InMemoryCheckpointStore {
+	return &InMemoryCheckpointStore{
+		checkpoints: make(map[string]int64),
+	}
+}
+
+//LoadCheckpoint returns the checkpoint for the named projection.
+func (cs *InMemoryCheckpointStore) LoadCheckpoint(name string) (int64, error) {
+	cs.RLock()
+	defer cs.RUnlock()
+	return cs.checkpoints[name], nil
+}
+
+//SaveCheckpoint saves the checkpoint for the named projection.
+func (cs *InMemoryCheckpointStore) SaveCheckpoint(name string, position int64) error {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.checkpoints[name] = position
+	return nil
+}
@@ -0,0 +1,235 @@
+package projection_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/projection"
+	"github.com/xtracdev/goes/sample"
+)
+
+//userNames projects the first name of each user.
+type userNames struct {
+	*projection.KeyValueModel[string]
+	projection.Handlers
+}
+
+func newUserNames() *userNames {
+	p := &userNames{KeyValueModel: projection.NewKeyValueModel[string]()}
+	p.Handlers = projection.Handlers{
+		sample.UserCreatedTypeCode: func(e goes.Event) error {
+			p.Put(e.Source, e.Payload.(sample.UserCreated).FirstName)
+			return nil
+		},
+		sample.UserFirstNameUpdatedTypeCode: func(e goes.Event) error {
+			p.Put(e.Source, e.Payload.(sample.UserFirstNameUpdated).NewFirst)
+			return nil
+		},
+	}
+	return p
+}
+
+func (p *userNames) Name() string {
+	return "user-names"
+}
+
+func storeUser(t *testing.T, store goes.EventStore, first string) *sample.User {
+	user, err := sample.NewUser(first, "last", "email")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+	return user
+}
+
+func TestRunnerCatchesUpAndSubscribes(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs)
+	defer store.Close()
+	checkpoints := projection.NewInMemoryCheckpointStore()
+
+	joe := storeUser(t, store, "joe")
+	storeUser(t, store, "jane")
+
+	names := newUserNames()
+	runner := projection.NewRunner(names, checkpoints).WithBatchSize(1)
+	assert.Nil(t, runner.CatchUp(store))
+	assert.Equal(t, 2, names.Len())
+
+	checkpoint, err := checkpoints.LoadCheckpoint("user-names")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), checkpoint)
+
+	assert.Nil(t, runner.Start(store))
+	assert.Nil(t, joe.UpdateFirstName("joseph"))
+	assert.Nil(t, joe.Store(store))
+	store.Drain()
+
+	name, _ := names.Get(joe.AggregateID)
+	assert.Equal(t, "joseph", name)
+	assert.Nil(t, runner.Stop())
+
+	checkpoint, err = checkpoints.LoadCheckpoint("user-names")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), checkpoint)
+
+	//A new runner resumes from the checkpoint
+	resumed := newUserNames()
+	assert.Nil(t, projection.NewRunner(resumed, checkpoints).CatchUp(store))
+	assert.Equal(t, 0, resumed.Len())
+}
+
+func TestRunnerRebuilds(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs)
+	defer store.Close()
+
+	names := newUserNames()
+	runner := projection.NewRunner(names, projection.NewInMemoryCheckpointStore())
+	assert.Nil(t, runner.Start(store))
+
+	joe := storeUser(t, store, "joe")
+	store.Drain()
+	names.Put(joe.AggregateID, "corrupted")
+
+	assert.Nil(t, runner.Rebuild(store))
+	store.Drain()
+
+	name, _ := names.Get(joe.AggregateID)
+	assert.Equal(t, "joe", name)
+	assert.Equal(t, int64(1), runner.Position())
+}
+
+func TestRunnerRebuildsWhileWriting(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs)
+	defer store.Close()
+	for i := 0; i < 50; i++ {
+		storeUser(t, store, "joe")
+	}
+
+	names := newUserNames()
+	runner := projection.NewRunner(names, projection.NewInMemoryCheckpointStore()).WithBatchSize(5)
+	assert.Nil(t, runner.Start(store))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			storeUser(t, store, "jane")
+		}
+	}()
+	assert.Nil(t, runner.Rebuild(store))
+	<-done
+	store.Drain()
+
+	assert.Equal(t, 100, names.Len())
+	assert.Equal(t, int64(100), runner.Position())
+	assert.Nil(t, runner.Stop())
+}
+
+func TestRunnerStopsOnError(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs)
+	defer store.Close()
+	storeUser(t, store, "joe")
+
+	failed := errors.New("projection failed")
+	names := newUserNames()
+	names.Handlers[sample.UserCreatedTypeCode] = func(goes.Event) error { return failed }
+
+	runner := projection.NewRunner(names, projection.NewInMemoryCheckpointStore())
+	assert.Equal(t, failed, runner.CatchUp(store))
+	assert.Equal(t, failed, runner.Err())
+	assert.Equal(t, int64(0), runner.Position())
+}
+
+//storeRenames stores a legacy event renaming the user twice, which the upcasters
+//returned by renameUpcasters split into two first name updates.
+func storeRenames(t *testing.T, store goes.EventStore, user *sample.User, first, second string) {
+	payload, _ := json.Marshal([]string{first, second})
+	user.Version++
+	user.Events = append(user.Events, goes.Event{
+		Source:   user.AggregateID,
+		Version:  user.Version,
+		TypeCode: "URENAMED",
+		Payload:  payload,
+	})
+	assert.Nil(t, user.Store(store))
+}
+
+func renameUpcasters() *goes.UpcasterChain {
+	upcasters := goes.NewUpcasterChain()
+	upcasters.Register("URENAMED", 0, func(e goes.Event) ([]goes.Event, error) {
+		var names []string
+		if err := json.Unmarshal(e.Payload.([]byte), &names); err != nil {
+			return nil, err
+		}
+
+		var events []goes.Event
+		for _, name := range names {
+			renamed := e
+			renamed.TypeCode = sample.UserFirstNameUpdatedTypeCode
+			renamed.Payload, _ = json.Marshal(sample.UserFirstNameUpdated{NewFirst: name})
+			events = append(events, renamed)
+		}
+		return events, nil
+	})
+	return upcasters
+}
+
+func TestRunnerHandlesSplitEvents(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs).WithUpcasters(renameUpcasters())
+	defer store.Close()
+	checkpoints := projection.NewInMemoryCheckpointStore()
+
+	joe := storeUser(t, store, "joe")
+	storeRenames(t, store, joe, "joseph", "jo")
+
+	names := newUserNames()
+	runner := projection.NewRunner(names, checkpoints)
+	assert.Nil(t, runner.CatchUp(store))
+	name, _ := names.Get(joe.AggregateID)
+	assert.Equal(t, "jo", name)
+
+	assert.Nil(t, runner.Start(store))
+	storeRenames(t, store, joe, "joey", "josie")
+	store.Drain()
+	name, _ = names.Get(joe.AggregateID)
+	assert.Equal(t, "josie", name)
+	assert.Nil(t, runner.Stop())
+
+	checkpoint, err := checkpoints.LoadCheckpoint("user-names")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), checkpoint)
+}
+
+func TestRunnerResumesPartlyHandledSplitEvent(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore().WithCodec(sample.Codecs).WithUpcasters(renameUpcasters())
+	defer store.Close()
+	checkpoints := projection.NewInMemoryCheckpointStore()
+
+	joe := storeUser(t, store, "joe")
+	storeRenames(t, store, joe, "joseph", "jo")
+
+	//The projection fails on the second event split from the stored event
+	failed := errors.New("projection failed")
+	names := newUserNames()
+	handle := names.Handlers[sample.UserFirstNameUpdatedTypeCode]
+	names.Handlers[sample.UserFirstNameUpdatedTypeCode] = func(e goes.Event) error {
+		if e.Payload.(sample.UserFirstNameUpdated).NewFirst == "jo" {
+			return failed
+		}
+		return handle(e)
+	}
+
+	runner := projection.NewRunner(names, checkpoints)
+	assert.Equal(t, failed, runner.CatchUp(store))
+	checkpoint, _ := checkpoints.LoadCheckpoint("user-names")
+	assert.Equal(t, int64(1), checkpoint)
+
+	names.Handlers[sample.UserFirstNameUpdatedTypeCode] = handle
+	assert.Nil(t, runner.CatchUp(store))
+	name, _ := names.Get(joe.AggregateID)
+	assert.Equal(t, "jo", name)
+	checkpoint, _ = checkpoints.LoadCheckpoint("user-names")
+	assert.Equal(t, int64(2), checkpoint)
+}
@@ -0,0 +1,328 @@
+package projection
+
+import (
+	"sync"
+
+	"github.com/xtracdev/goes"
+)
+
+//DefaultBatchSize is the number of events handled between checkpoints when no batch
+//size is configured.
+const DefaultBatchSize = 100
+
+//Runner feeds events to a projection, and records the position of the last event
+//handled as the projection's checkpoint after each batch of events. A projection is
+//fed either by reading the store's global log with CatchUp, or by subscribing to the
+//store with Start; in both cases it resumes from its checkpoint.
+//
+//Events are handled at least once: events handled since the last checkpoint was saved
+//are handled again after a restart. Events with a log position at or before the last
+//event handled are skipped, so a projection is not fed the events republished to the
+//store's subscribers. Events split from one stored event by upcasting share its log
+//position, and are all handled; the checkpoint is only moved past a position once every
+//event split from it has been handled, if the runner can read the store's log.
+//
+//If the projection fails to handle an event, the runner stops feeding it events and
+//reports the error from Err. Calling CatchUp retries from the failed event.
+type Runner struct {
+	sync.Mutex
+	projection   Projection
+	checkpoints  CheckpointStore
+	batchSize    int
+	loaded       bool
+	position     int64
+	handled      int
+	complete     bool
+	saved        int64
+	err          error
+	reader       goes.EventLogReader
+	publisher    goes.EventPublisher
+	subscription goes.SubscriptionID
+}
+
+//NewRunner creates a runner for the projection, keeping its checkpoint in the
+//checkpoint store.
+func NewRunner(projection Projection, checkpoints CheckpointStore) *Runner {
+	return &Runner{
+		projection:  projection,
+		checkpoints: checkpoints,
+		batchSize:   DefaultBatchSize,
+	}
+}
+
+//WithBatchSize sets the number of events handled between checkpoints, which is also the
+//number of events read from the log at a time. A size of zero or less uses
+//DefaultBatchSize.
+func (r *Runner) WithBatchSize(batchSize int) *Runner {
+	r.Lock()
+	defer r.Unlock()
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	r.batchSize = batchSize
+	return r
+}
+
+//loadLocked loads the projection's checkpoint, the first time it is needed.
+func (r *Runner) loadLocked() error {
+	if r.loaded {
+		return nil
+	}
+
+	position, err := r.checkpoints.LoadCheckpoint(r.projection.Name())
+	if err != nil {
+		return err
+	}
+
+	r.position, r.handled, r.complete, r.saved, r.loaded = position, 0, true, position, true
+	return nil
+}
+
+//unhandledLocked returns the events at the position of the last event handled that
+//have not been handled yet, which happens when the runner stops part way through the
+//events split from one stored event. It returns nothing if the runner cannot read the
+//store's log.
+func (r *Runner) unhandledLocked() ([]goes.Event, error) {
+	if r.complete || r.reader == nil {
+		return nil, nil
+	}
+
+	events, err := r.reader.ReadEventLog(r.position, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var unhandled []goes.Event
+	for _, e := range events {
+		if e.Position == r.position {
+			unhandled = append(unhandled, e)
+		}
+	}
+	if len(unhandled) <= r.handled {
+		r.complete = true
+		return nil, nil
+	}
+	return unhandled[r.handled:], nil
+}
+
+//handleUnhandledLocked feeds the projection the events split from the same stored event
+//as the last event handled that have not been handled yet.
+func (r *Runner) handleUnhandledLocked() error {
+	unhandled, err := r.unhandledLocked()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range unhandled {
+		if err := r.handleLocked(e); err != nil {
+			r.err = err
+			r.saveLocked()
+			return err
+		}
+	}
+	if len(unhandled) > 0 {
+		r.complete = true
+	}
+	return nil
+}
+
+//saveLocked saves the position of the last event handled as the checkpoint, if it has
+//moved on since the checkpoint was last saved. If some of the events at that position
+//have not been handled yet, the position before it is saved instead.
+func (r *Runner) saveLocked() error {
+	position := r.position
+	unhandled, err := r.unhandledLocked()
+	if err != nil {
+		return err
+	}
+	if len(unhandled) > 0 {
+		position--
+	}
+
+	if position == r.saved {
+		return nil
+	}
+
+	if err := r.checkpoints.SaveCheckpoint(r.projection.Name(), position); err != nil {
+		return err
+	}
+
+	r.saved = position
+	return nil
+}
+
+//handleLocked feeds the event to the projection, unless it has already been handled.
+//Events at the position of the last event handled follow on from it, split from the
+//same stored event, unless every event at that position is known to have been handled.
+func (r *Runner) handleLocked(event goes.Event) error {
+	if event.Position != 0 && (event.Position < r.position || event.Position == r.position && r.complete) {
+		return nil
+	}
+
+	if err := r.projection.Handle(event); err != nil {
+		return err
+	}
+
+	switch {
+	case event.Position == 0:
+	case event.Position == r.position:
+		r.handled++
+	default:
+		r.position, r.handled, r.complete = event.Position, 1, false
+	}
+	return nil
+}
+
+//CatchUp feeds the projection the events in the store's log after its checkpoint, a
+//batch at a time, returning once it has handled every event in the log.
+func (r *Runner) CatchUp(reader goes.EventLogReader) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if err := r.loadLocked(); err != nil {
+		return err
+	}
+	return r.catchUpLocked(reader)
+}
+
+func (r *Runner) catchUpLocked(reader goes.EventLogReader) error {
+	r.err = nil
+	r.reader = reader
+
+	if err := r.handleUnhandledLocked(); err != nil {
+		return err
+	}
+
+	for {
+		batch, err := reader.ReadEventLog(r.position+1, r.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return r.saveLocked()
+		}
+
+		for _, e := range batch {
+			if err := r.handleLocked(e); err != nil {
+				r.err = err
+				r.saveLocked()
+				return err
+			}
+		}
+
+		//The log is read a stored event at a time, so the batch holds every event
+		//split from the last stored event read
+		r.complete = true
+		if err := r.saveLocked(); err != nil {
+			return err
+		}
+	}
+}
+
+//Start subscribes the runner to the events published by the store, feeding them to
+//the projection as they are delivered. If the publisher is a CatchUpSubscriber the
+//events stored after the projection's checkpoint are replayed first.
+func (r *Runner) Start(publisher goes.EventPublisher) error {
+	r.Lock()
+	err := r.loadLocked()
+	if reader, ok := publisher.(goes.EventLogReader); ok && err == nil {
+		r.reader = reader
+		err = r.handleUnhandledLocked()
+	}
+	from := r.position + 1
+	r.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var subscription goes.SubscriptionID
+	if catchUp, ok := publisher.(goes.CatchUpSubscriber); ok {
+		if subscription, err = catchUp.SubscribeFrom(from, r.deliver); err != nil {
+			return err
+		}
+	} else {
+		subscription = publisher.SubscribeEvents(r.deliver)
+	}
+
+	r.Lock()
+	r.publisher, r.subscription = publisher, subscription
+	r.Unlock()
+
+	return nil
+}
+
+//deliver is the subscription callback, saving a checkpoint after each batch of events.
+func (r *Runner) deliver(event goes.Event) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	if err := r.handleLocked(event); err != nil {
+		r.err = err
+		return
+	}
+
+	if r.position-r.saved >= int64(r.batchSize) {
+		r.err = r.saveLocked()
+	}
+}
+
+//Stop unsubscribes the runner from the store, then saves the projection's checkpoint.
+func (r *Runner) Stop() error {
+	r.Lock()
+	publisher, subscription := r.publisher, r.subscription
+	r.publisher = nil
+	r.Unlock()
+
+	if publisher != nil {
+		publisher.Unsubscribe(subscription)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	return r.saveLocked()
+}
+
+//Rebuild resets the projection's read model and checkpoint, then feeds it every event
+//in the store's log. If the runner has been started, the events its subscription
+//delivers while the rebuild is in progress wait until the rebuild has finished, and
+//are skipped if the rebuild has already handled them. The projection must implement
+//Resetter.
+func (r *Runner) Rebuild(reader goes.EventLogReader) error {
+	r.Lock()
+	defer r.Unlock()
+
+	resetter, ok := r.projection.(Resetter)
+	if !ok {
+		return ErrNotResettable
+	}
+
+	if err := resetter.Reset(); err != nil {
+		return err
+	}
+
+	r.position, r.handled, r.complete, r.err, r.loaded = 0, 0, true, nil, true
+	if err := r.checkpoints.SaveCheckpoint(r.projection.Name(), 0); err != nil {
+		return err
+	}
+	r.saved = 0
+
+	return r.catchUpLocked(reader)
+}
+
+//Position returns the log position of the last event the projection handled.
+func (r *Runner) Position() int64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.position
+}
+
+//Err returns the error the projection failed with, if it has stopped handling events.
+func (r *Runner) Err() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.err
+}
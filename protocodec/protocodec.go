@@ -0,0 +1,31 @@
+//Package protocodec provides a goes.Codec for event payloads defined as protocol
+//buffer messages.
+package protocodec
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+//Codec is a goes.Codec that serializes payloads using protocol buffers. Payloads must
+//be generated protobuf message types.
+type Codec struct{}
+
+//Marshal returns the protobuf encoding of v.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a protobuf message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+//Unmarshal decodes the protobuf encoded data into v.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a protobuf message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
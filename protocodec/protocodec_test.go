@@ -0,0 +1,29 @@
+package protocodec_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/protocodec"
+	"github.com/xtracdev/goes/sample/testagg"
+)
+
+func TestProtoCodecRoundTrip(t *testing.T) {
+	registry := goes.NewTypeRegistry()
+	registry.MustRegister("TACRE", testagg.TestAggCreated{}, protocodec.Codec{})
+
+	created := testagg.TestAggCreated{AggregateId: "agg", Foo: "foo", Bar: "bar", Baz: "baz"}
+	encoded, err := registry.EncodeEvent(goes.Event{Source: "agg", Version: 1, Payload: created})
+	assert.Nil(t, err)
+	assert.Equal(t, "TACRE", encoded.TypeCode)
+
+	decoded, err := registry.DecodeEvent(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, created, decoded.Payload)
+}
+
+func TestProtoCodecRequiresMessages(t *testing.T) {
+	_, err := protocodec.Codec{}.Marshal(&struct{ Name string }{"joe"})
+	assert.NotNil(t, err)
+}
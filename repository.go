@@ -0,0 +1,281 @@
+package goes
+
+import "errors"
+
+//DefaultUpdateRetries is the number of times Update retries a command that loses an
+//optimistic concurrency race, unless the repository is configured otherwise.
+const DefaultUpdateRetries = 3
+
+//DefaultSnapshotInterval is the number of events between snapshots used when a
+//repository picks up snapshot support from its event store.
+const DefaultSnapshotInterval = 100
+
+//EventDecoder converts the events read from an event store into the form routed to
+//an aggregate, for example by unmarshalling their payloads.
+type EventDecoder func([]Event) ([]Event, error)
+
+//Repository loads and saves event sourced aggregates of type T using an event store,
+//replacing the hand written retrieve, rebuild and store code each aggregate would
+//otherwise need.
+//
+//If a codec is configured, event payloads are encoded with it when saving and decoded
+//when loading, so the aggregate's Store method is not used.
+//
+//If a snapshot store is configured and T implements Snapshotter, aggregates are loaded
+//from their latest snapshot and snapshots are saved according to the snapshot policy.
+type Repository[T EventSourcedAggregate] struct {
+	store     EventStore
+	factory   func() T
+	decoder   EventDecoder
+	codec     EventCodec
+	upcasters *UpcasterChain
+	snapshots SnapshotStore
+	policy    SnapshotPolicy
+	retries   int
+	clone     func(T) T
+}
+
+//NewRepository creates a repository for aggregates stored in the event store. The
+//factory must return a new, empty aggregate with its embedded Aggregate allocated.
+//If the event store is also a SnapshotStore it is used for snapshots, taking a
+//snapshot every DefaultSnapshotInterval events.
+func NewRepository[T EventSourcedAggregate](store EventStore, factory func() T) *Repository[T] {
+	repo := &Repository[T]{
+		store:   store,
+		factory: factory,
+		retries: DefaultUpdateRetries,
+	}
+
+	if snapshots, ok := store.(SnapshotStore); ok {
+		repo.snapshots = snapshots
+		repo.policy = EveryNEvents(DefaultSnapshotInterval)
+	}
+
+	return repo
+}
+
+//WithDecoder sets the decoder applied to events read from the store before they are
+//routed to the aggregate.
+func (r *Repository[T]) WithDecoder(decoder EventDecoder) *Repository[T] {
+	r.decoder = decoder
+	return r
+}
+
+//WithCodec sets the codec used to encode events when saving and decode them when
+//loading.
+func (r *Repository[T]) WithCodec(codec EventCodec) *Repository[T] {
+	r.codec = codec
+	return r
+}
+
+//WithUpcasters sets the upcaster chain applied to events read from the store before
+//they are decoded.
+func (r *Repository[T]) WithUpcasters(upcasters *UpcasterChain) *Repository[T] {
+	r.upcasters = upcasters
+	return r
+}
+
+//WithSnapshots configures the snapshot store and the policy deciding when snapshots
+//are taken.
+func (r *Repository[T]) WithSnapshots(snapshots SnapshotStore, policy SnapshotPolicy) *Repository[T] {
+	r.snapshots = snapshots
+	r.policy = policy
+	return r
+}
+
+//WithClone sets the function History uses to copy the aggregate's state after each
+//version. The copy must not share any state the aggregate's event handlers change.
+func (r *Repository[T]) WithClone(clone func(T) T) *Repository[T] {
+	r.clone = clone
+	return r
+}
+
+//WithUpdateRetries sets the number of times Update retries after a concurrency
+//conflict.
+func (r *Repository[T]) WithUpdateRetries(retries int) *Repository[T] {
+	r.retries = retries
+	return r
+}
+
+//Load creates the aggregate with the given id and applies its event history,
+//starting from its latest snapshot if there is one.
+func (r *Repository[T]) Load(aggregateID string) (T, error) {
+	return r.load(aggregateID, 0)
+}
+
+//load creates the aggregate with the given id and applies its event history up to and
+//including toVersion, or all of it if toVersion is zero. The latest snapshot is used if
+//it was taken at or before toVersion.
+func (r *Repository[T]) load(aggregateID string, toVersion int) (T, error) {
+	var zero T
+
+	agg := r.factory()
+	root := agg.AggregateRoot()
+	root.AggregateID = aggregateID
+	root.Version = 0
+
+	query := RangeQuery{ToVersion: toVersion}
+	if snapshotter, ok := any(agg).(Snapshotter); ok && r.snapshots != nil {
+		snapshot, err := r.snapshots.LoadSnapshot(aggregateID)
+		if err != nil {
+			return zero, err
+		}
+
+		if snapshot != nil && (toVersion < 1 || snapshot.Version <= toVersion) {
+			if err := snapshotter.RestoreSnapshot(*snapshot); err != nil {
+				return zero, err
+			}
+			root.Version = snapshot.Version
+			query.FromVersion = snapshot.Version + 1
+		}
+	}
+
+	events, lastVersion, err := r.readEvents(aggregateID, query)
+	if err != nil {
+		return zero, err
+	}
+
+	//The aggregate is at the version of the last stored event, however many events
+	//upcasting turns the stored events into
+	storedVersion := root.Version
+	if lastVersion > 0 {
+		storedVersion = lastVersion
+	}
+
+	for _, e := range events {
+		root.Version++
+		if err := agg.Route(e); err != nil {
+			return zero, err
+		}
+	}
+
+	root.Version = storedVersion
+	root.Events = nil
+
+	return agg, nil
+}
+
+//readEvents reads the aggregate's events selected by the query, upcast and decoded
+//ready to be routed to the aggregate. It also returns the version of the last stored
+//event read, or zero if none were read.
+func (r *Repository[T]) readEvents(aggregateID string, query RangeQuery) ([]Event, int, error) {
+	events, err := RetrieveEventRange(r.store, aggregateID, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastVersion int
+	if len(events) > 0 {
+		lastVersion = events[len(events)-1].Version
+	}
+
+	if r.upcasters != nil {
+		if events, err = r.upcasters.UpcastEvents(events); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if r.codec != nil {
+		if events, err = DecodeEvents(r.codec, events); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if r.decoder != nil {
+		if events, err = r.decoder(events); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return events, lastVersion, nil
+}
+
+//Save stores the aggregate's uncommitted events, then saves a snapshot of the
+//aggregate if the snapshot policy calls for one. An aggregate with no uncommitted
+//events is left as it is.
+func (r *Repository[T]) Save(agg T) error {
+	if len(agg.AggregateRoot().Events) == 0 {
+		return nil
+	}
+
+	if err := r.storeAggregate(agg); err != nil {
+		return err
+	}
+
+	snapshotter, ok := any(agg).(Snapshotter)
+	if !ok || r.snapshots == nil || r.policy == nil {
+		return nil
+	}
+
+	root := agg.AggregateRoot()
+	var lastVersion int
+	last, err := r.snapshots.LoadSnapshot(root.AggregateID)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		lastVersion = last.Version
+	}
+
+	if !r.policy.ShouldSnapshot(lastVersion, root.Version) {
+		return nil
+	}
+
+	snapshot, err := snapshotter.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	return r.snapshots.SaveSnapshot(snapshot)
+}
+
+func (r *Repository[T]) storeAggregate(agg T) error {
+	if r.codec == nil {
+		return agg.Store(r.store)
+	}
+
+	root := agg.AggregateRoot()
+	encoded, err := EncodeEvents(r.codec, root.Events)
+	if err != nil {
+		return err
+	}
+
+	err = r.store.StoreEvents(&Aggregate{
+		AggregateID: root.AggregateID,
+		Version:     root.Version,
+		Events:      encoded,
+	})
+	if err != nil {
+		return err
+	}
+
+	root.Events = nil
+
+	return nil
+}
+
+//Update loads the aggregate, calls command with it, then saves the events the command
+//produced. If the save loses an optimistic concurrency race the aggregate is reloaded
+//and the command run again, up to the configured number of retries. An error returned
+//by command is returned without saving.
+func (r *Repository[T]) Update(aggregateID string, command func(T) error) error {
+	var err error
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		var agg T
+		agg, err = r.Load(aggregateID)
+		if err != nil {
+			return err
+		}
+
+		if err = command(agg); err != nil {
+			return err
+		}
+
+		err = r.Save(agg)
+		if !errors.Is(err, ErrConcurrency) {
+			return err
+		}
+	}
+
+	return err
+}
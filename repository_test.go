@@ -0,0 +1,126 @@
+package goes_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+	"github.com/xtracdev/goes/sample/testagg"
+)
+
+func TestRepositoryLoadAndSave(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	repo := sample.NewUserRepository(store)
+
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	user.UpdateFirstName("new first")
+	assert.Nil(t, repo.Save(user))
+
+	loaded, err := repo.Load(user.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, user.AggregateID, loaded.AggregateID)
+	assert.Equal(t, 2, loaded.Version)
+	assert.Equal(t, "new first", loaded.FirstName)
+	assert.Equal(t, 0, len(loaded.Events))
+
+	_, err = repo.Load("no-such-aggregate")
+	assert.True(t, errors.Is(err, goes.ErrAggregateNotFound))
+}
+
+func TestRepositoryUpdateRetriesConflicts(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	repo := sample.NewUserRepository(store)
+
+	user, _ := sample.NewUser("first", "last", "email")
+	assert.Nil(t, repo.Save(user))
+
+	attempts := 0
+	err := repo.Update(user.AggregateID, func(u *sample.User) error {
+		attempts++
+		if attempts == 1 {
+			//Someone else updates the user before this command is saved
+			assert.Nil(t, repo.Update(user.AggregateID, func(other *sample.User) error {
+				other.UpdateFirstName("other first")
+				return nil
+			}))
+		}
+		u.UpdateFirstName("my first")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+
+	loaded, err := repo.Load(user.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, loaded.Version)
+	assert.Equal(t, "my first", loaded.FirstName)
+}
+
+func TestRepositoryUpdateCommandError(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	repo := sample.NewUserRepository(store)
+
+	user, _ := sample.NewUser("first", "last", "email")
+	assert.Nil(t, repo.Save(user))
+
+	commandErr := errors.New("invalid command")
+	err := repo.Update(user.AggregateID, func(u *sample.User) error {
+		u.UpdateFirstName("not saved")
+		return commandErr
+	})
+	assert.Equal(t, commandErr, err)
+
+	loaded, _ := repo.Load(user.AggregateID)
+	assert.Equal(t, 1, loaded.Version)
+}
+
+func TestRepositoryUpdateWithoutEvents(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	repo := sample.NewUserRepository(store)
+
+	user, _ := sample.NewUser("first", "last", "email")
+	assert.Nil(t, repo.Save(user))
+
+	attempts := 0
+	err := repo.Update(user.AggregateID, func(*sample.User) error {
+		attempts++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, attempts)
+
+	loaded, _ := repo.Load(user.AggregateID)
+	assert.Equal(t, 1, loaded.Version)
+}
+
+func TestRepositorySnapshots(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	snapshots := inmemes.NewInMemorySnapshotStore()
+	repo := testagg.NewTestAggRepository(store).WithSnapshots(snapshots, goes.EveryNEvents(5))
+
+	ta, _ := testagg.NewTestAgg("foo", "bar", "baz")
+	assert.Nil(t, repo.Save(ta))
+	for i := 0; i < 11; i++ {
+		assert.Nil(t, repo.Update(ta.AggregateID, func(agg *testagg.TestAgg) error {
+			agg.UpdateFoo(fmt.Sprintf("foo %d", i))
+			return nil
+		}))
+	}
+
+	snapshot, err := snapshots.LoadSnapshot(ta.AggregateID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, snapshot) {
+		assert.Equal(t, 10, snapshot.Version)
+	}
+
+	loaded, err := repo.Load(ta.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, 12, loaded.Version)
+	assert.Equal(t, "foo 10", loaded.Foo)
+	assert.Equal(t, "bar", loaded.Bar)
+}
@@ -0,0 +1,122 @@
+package goes
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//UnknownEventPolicy determines what a Router does with an event whose payload type
+//has no registered handler.
+type UnknownEventPolicy int
+
+const (
+	//UnknownEventError returns an error wrapping ErrUnknownEventType.
+	UnknownEventError UnknownEventPolicy = iota
+	//UnknownEventIgnore ignores the event.
+	UnknownEventIgnore
+	//UnknownEventPanic panics with the error UnknownEventError would return.
+	UnknownEventPanic
+)
+
+//handlerMethodPrefix prefixes the names of the methods RegisterMethods registers as
+//event handlers, for example OnUserCreated handles UserCreated payloads.
+const handlerMethodPrefix = "On"
+
+//Router routes events to handlers on an aggregate of type T according to the type of
+//the event payload, replacing the type switch an aggregate's Route method would
+//otherwise need. A router is typically created once per aggregate type and shared by
+//all instances; it must not be modified once it is in use.
+type Router[T any] struct {
+	handlers map[reflect.Type]func(T, Event) error
+	policy   UnknownEventPolicy
+}
+
+//NewRouter creates a router with no handlers, using the given policy for events
+//with unknown payload types.
+func NewRouter[T any](policy UnknownEventPolicy) *Router[T] {
+	return &Router[T]{
+		handlers: make(map[reflect.Type]func(T, Event) error),
+		policy:   policy,
+	}
+}
+
+//Handle registers handler for events with a payload of type P. Method expressions
+//such as (*User).handleUserCreated can be registered directly.
+func Handle[T any, P any](r *Router[T], handler func(T, P)) {
+	r.handlers[reflect.TypeOf((*P)(nil)).Elem()] = func(target T, event Event) error {
+		handler(target, event.Payload.(P))
+		return nil
+	}
+}
+
+//RegisterMethods registers the exported methods of T named On<PayloadType> that take a
+//single payload argument, and return nothing or an error, as handlers for that
+//payload type.
+func (r *Router[T]) RegisterMethods() *Router[T] {
+	targetType := reflect.TypeOf((*T)(nil)).Elem()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+
+	for i := 0; i < targetType.NumMethod(); i++ {
+		method := targetType.Method(i)
+		if !strings.HasPrefix(method.Name, handlerMethodPrefix) {
+			continue
+		}
+
+		//Method types from reflect.Type include the receiver as the first argument
+		methodType := method.Type
+		if methodType.NumIn() != 2 || methodType.NumOut() > 1 {
+			continue
+		}
+		if methodType.NumOut() == 1 && methodType.Out(0) != errorType {
+			continue
+		}
+
+		payloadType := methodType.In(1)
+		if method.Name != handlerMethodPrefix+payloadType.Name() {
+			continue
+		}
+
+		fn := method.Func
+		r.handlers[payloadType] = func(target T, event Event) error {
+			out := fn.Call([]reflect.Value{reflect.ValueOf(target), reflect.ValueOf(event.Payload)})
+			if len(out) == 1 && !out[0].IsNil() {
+				return out[0].Interface().(error)
+			}
+			return nil
+		}
+	}
+
+	return r
+}
+
+//Route calls the handler registered for the event's payload type. Events with pointer
+//payloads are routed to the handler for the type pointed to if there is no handler for
+//the pointer type itself.
+func (r *Router[T]) Route(target T, event Event) error {
+	payloadType := reflect.TypeOf(event.Payload)
+	handler, ok := r.handlers[payloadType]
+
+	if !ok && payloadType != nil && payloadType.Kind() == reflect.Ptr {
+		ptr := reflect.ValueOf(event.Payload)
+		if handler, ok = r.handlers[payloadType.Elem()]; ok && !ptr.IsNil() {
+			event.Payload = ptr.Elem().Interface()
+		} else {
+			ok = false
+		}
+	}
+
+	if ok {
+		return handler(target, event)
+	}
+
+	err := fmt.Errorf("%w: %T", ErrUnknownEventType, event.Payload)
+	switch r.policy {
+	case UnknownEventIgnore:
+		return nil
+	case UnknownEventPanic:
+		panic(err)
+	}
+
+	return err
+}
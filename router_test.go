@@ -0,0 +1,80 @@
+package goes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Counted struct {
+	By int
+}
+
+type Reset struct{}
+
+type Rejected struct{}
+
+type counter struct {
+	Count int
+}
+
+func (c *counter) OnCounted(event Counted) {
+	c.Count += event.By
+}
+
+func (c *counter) OnReset(event Reset) {
+	c.Count = 0
+}
+
+func (c *counter) OnRejected(event Rejected) error {
+	return errors.New("rejected")
+}
+
+//OnSomethingElse does not match its argument type and is not registered.
+func (c *counter) OnSomethingElse(event Counted) {
+	c.Count = -1
+}
+
+func TestRouterHandle(t *testing.T) {
+	router := NewRouter[*counter](UnknownEventError)
+	Handle(router, func(c *counter, event Counted) {
+		c.Count += event.By
+	})
+
+	c := new(counter)
+	assert.Nil(t, router.Route(c, Event{Payload: Counted{By: 2}}))
+	assert.Nil(t, router.Route(c, Event{Payload: &Counted{By: 3}}))
+	assert.Equal(t, 5, c.Count)
+
+	err := router.Route(c, Event{Payload: Reset{}})
+	assert.True(t, errors.Is(err, ErrUnknownEventType))
+
+	err = router.Route(c, Event{})
+	assert.True(t, errors.Is(err, ErrUnknownEventType))
+}
+
+func TestRouterRegisterMethods(t *testing.T) {
+	router := NewRouter[*counter](UnknownEventError).RegisterMethods()
+
+	c := new(counter)
+	assert.Nil(t, router.Route(c, Event{Payload: Counted{By: 4}}))
+	assert.Equal(t, 4, c.Count)
+
+	assert.Nil(t, router.Route(c, Event{Payload: Reset{}}))
+	assert.Equal(t, 0, c.Count)
+
+	assert.EqualError(t, router.Route(c, Event{Payload: Rejected{}}), "rejected")
+}
+
+func TestRouterUnknownEventPolicies(t *testing.T) {
+	c := new(counter)
+
+	ignore := NewRouter[*counter](UnknownEventIgnore)
+	assert.Nil(t, ignore.Route(c, Event{Payload: Reset{}}))
+
+	panics := NewRouter[*counter](UnknownEventPanic)
+	assert.Panics(t, func() {
+		panics.Route(c, Event{Payload: Reset{}})
+	})
+}
@@ -0,0 +1,272 @@
+package saga
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+//Coordinator runs the instances of a saga: it feeds them the events they are correlated
+//with, fires their timeouts as they fall due, and sends the commands they issue.
+//
+//Instances are stored in an event store, which may be the store the events come from as
+//long as the store lets its subscribers write to it while they handle events, as the
+//in memory store does.
+//Commands are sent once the instance that issued them has been stored, and the sending
+//of each command is recorded; a command that could not be sent is retried the next time
+//its instance handles an event or timeout, or when the coordinator is resumed.
+//
+//Instance events carry command payloads as they are given to Context.Send, so the
+//instance store must either hold events in memory or use a codec able to serialize the
+//saga events and commands.
+//
+//A coordinator handles one event or timeout at a time, and must be the only coordinator
+//for its saga writing to the store.
+type Coordinator struct {
+	sync.Mutex
+	definition Definition
+	repository *goes.Repository[*Instance]
+	sender     CommandSender
+	clock      func() time.Time
+
+	//timeouts holds the deadlines of the timeouts scheduled by each instance
+	timeouts map[string]map[string]time.Time
+
+	publisher    goes.EventPublisher
+	subscription goes.SubscriptionID
+	err          error
+}
+
+//NewCoordinator creates a coordinator for the saga, storing its instances in the event
+//store and sending their commands with the sender.
+func NewCoordinator(definition Definition, store goes.EventStore, sender CommandSender) *Coordinator {
+	return &Coordinator{
+		definition: definition,
+		repository: goes.NewRepository(store, newEmptyInstance),
+		sender:     sender,
+		clock:      time.Now,
+		timeouts:   make(map[string]map[string]time.Time),
+	}
+}
+
+//WithClock sets the function the coordinator uses to tell the time, which defaults to
+//time.Now.
+func (c *Coordinator) WithClock(clock func() time.Time) *Coordinator {
+	c.Lock()
+	defer c.Unlock()
+	c.clock = clock
+	return c
+}
+
+//load loads the instance with the given key, returning nil if there is none.
+func (c *Coordinator) load(key string) (*Instance, error) {
+	instance, err := c.repository.Load(instanceID(c.definition.Name(), key))
+	if errors.Is(err, goes.ErrAggregateNotFound) {
+		return nil, nil
+	}
+	return instance, err
+}
+
+//save stores the instance, then sends any commands it has issued that have not been
+//sent.
+func (c *Coordinator) save(instance *Instance) error {
+	if len(instance.Events) > 0 {
+		if err := c.repository.Save(instance); err != nil {
+			return err
+		}
+	}
+
+	if len(instance.timeouts) == 0 {
+		delete(c.timeouts, instance.AggregateID)
+	} else {
+		deadlines := make(map[string]time.Time, len(instance.timeouts))
+		for name, deadline := range instance.timeouts {
+			deadlines[name] = deadline
+		}
+		c.timeouts[instance.AggregateID] = deadlines
+	}
+
+	pending := append([]Command(nil), instance.pending...)
+	for _, command := range pending {
+		if err := c.sender.Send(command); err != nil {
+			return err
+		}
+
+		if err := instance.apply(CommandSent{CommandID: command.ID}); err != nil {
+			return err
+		}
+		if err := c.repository.Save(instance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Handle feeds the event to the saga instance it is correlated with, starting a new
+//instance if the event starts one. Events the instance has already handled are ignored.
+func (c *Coordinator) Handle(event goes.Event) error {
+	if strings.HasPrefix(event.TypeCode, typeCodePrefix) {
+		return nil
+	}
+
+	key, starts := c.definition.Correlate(event)
+	if key == "" {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	instance, err := c.load(key)
+	if err != nil {
+		return err
+	}
+
+	if instance == nil {
+		if !starts {
+			return nil
+		}
+		if instance, err = newInstance(c.definition.Name(), key); err != nil {
+			return err
+		}
+	}
+
+	if instance.Completed || (event.EventID != "" && instance.handled[event.EventID]) {
+		return c.save(instance)
+	}
+
+	if err := c.definition.Handle(&Context{instance: instance, now: c.clock()}, event); err != nil {
+		return err
+	}
+
+	if err := instance.apply(EventHandled{EventID: event.EventID}); err != nil {
+		return err
+	}
+	return c.save(instance)
+}
+
+//FireTimeouts feeds the timeouts that have fallen due to their saga instances, in
+//deadline order.
+func (c *Coordinator) FireTimeouts() error {
+	c.Lock()
+	defer c.Unlock()
+
+	type due struct {
+		id       string
+		name     string
+		deadline time.Time
+	}
+
+	now := c.clock()
+	var fired []due
+	for id, deadlines := range c.timeouts {
+		for name, deadline := range deadlines {
+			if !deadline.After(now) {
+				fired = append(fired, due{id, name, deadline})
+			}
+		}
+	}
+	sort.Slice(fired, func(i, j int) bool {
+		return fired[i].deadline.Before(fired[j].deadline)
+	})
+
+	for _, d := range fired {
+		instance, err := c.repository.Load(d.id)
+		if err != nil {
+			return err
+		}
+
+		//The timeout may have been cancelled or rescheduled since it was recorded
+		if deadline, ok := instance.timeouts[d.name]; !ok || !deadline.Equal(d.deadline) {
+			if err := c.save(instance); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := c.definition.Timeout(&Context{instance: instance, now: now}, d.name); err != nil {
+			return err
+		}
+
+		if err := instance.apply(TimeoutFired{Name: d.name}); err != nil {
+			return err
+		}
+		if err := c.save(instance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Resume restores the coordinator's record of scheduled timeouts after a restart, and
+//sends any commands left unsent, by loading every instance of the saga found in the
+//store's log.
+func (c *Coordinator) Resume(reader goes.EventLogReader) error {
+	c.Lock()
+	defer c.Unlock()
+
+	prefix := instanceID(c.definition.Name(), "")
+	var ids []string
+	events, err := reader.ReadEventLog(1, 0)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if e.TypeCode == StartedTypeCode && strings.HasPrefix(e.Source, prefix) {
+			ids = append(ids, e.Source)
+		}
+	}
+
+	for _, id := range ids {
+		instance, err := c.repository.Load(id)
+		if err != nil {
+			return err
+		}
+		if err := c.save(instance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Start subscribes the coordinator to the events published by the store. Errors handling
+//events are reported by Err.
+func (c *Coordinator) Start(publisher goes.EventPublisher) {
+	subscription := publisher.SubscribeEvents(func(event goes.Event) {
+		if err := c.Handle(event); err != nil {
+			c.Lock()
+			c.err = err
+			c.Unlock()
+		}
+	})
+
+	c.Lock()
+	c.publisher, c.subscription = publisher, subscription
+	c.Unlock()
+}
+
+//Stop unsubscribes the coordinator from the store.
+func (c *Coordinator) Stop() {
+	c.Lock()
+	publisher, subscription := c.publisher, c.subscription
+	c.publisher = nil
+	c.Unlock()
+
+	if publisher != nil {
+		publisher.Unsubscribe(subscription)
+	}
+}
+
+//Err returns the last error handling a published event.
+func (c *Coordinator) Err() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
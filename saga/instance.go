@@ -0,0 +1,231 @@
+package saga
+
+import (
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+//Type codes identifying the events recorded on saga instances.
+const (
+	StartedTypeCode          = "SAGA.STARTED"
+	EventHandledTypeCode     = "SAGA.EVENT_HANDLED"
+	StateSetTypeCode         = "SAGA.STATE_SET"
+	CommandIssuedTypeCode    = "SAGA.COMMAND_ISSUED"
+	CommandSentTypeCode      = "SAGA.COMMAND_SENT"
+	TimeoutScheduledTypeCode = "SAGA.TIMEOUT_SCHEDULED"
+	TimeoutCancelledTypeCode = "SAGA.TIMEOUT_CANCELLED"
+	TimeoutFiredTypeCode     = "SAGA.TIMEOUT_FIRED"
+	CompletedTypeCode        = "SAGA.COMPLETED"
+)
+
+//typeCodePrefix prefixes the type codes of the saga instance events.
+const typeCodePrefix = "SAGA."
+
+//Started is recorded when a saga instance is created.
+type Started struct {
+	Saga string
+	Key  string
+}
+
+//EventHandled is recorded when a saga instance has handled an event.
+type EventHandled struct {
+	EventID string
+}
+
+//StateSet is recorded when a state variable of a saga instance is set.
+type StateSet struct {
+	Name  string
+	Value string
+}
+
+//CommandIssued is recorded when a saga instance issues a command.
+type CommandIssued struct {
+	Command Command
+}
+
+//CommandSent is recorded once an issued command has been sent.
+type CommandSent struct {
+	CommandID string
+}
+
+//TimeoutScheduled is recorded when a saga instance schedules a timeout.
+type TimeoutScheduled struct {
+	Name     string
+	Deadline time.Time
+}
+
+//TimeoutCancelled is recorded when a saga instance cancels a timeout.
+type TimeoutCancelled struct {
+	Name string
+}
+
+//TimeoutFired is recorded when a saga instance has handled a timeout.
+type TimeoutFired struct {
+	Name string
+}
+
+//Completed is recorded when a saga instance completes.
+type Completed struct{}
+
+//Instance is the event sourced state of a saga instance.
+type Instance struct {
+	*goes.Aggregate
+	Saga      string
+	Key       string
+	State     map[string]string
+	Completed bool
+
+	handled  map[string]bool
+	timeouts map[string]time.Time
+	pending  []Command
+}
+
+//instanceID returns the aggregate id of the saga's instance with the given key.
+func instanceID(saga, key string) string {
+	return saga + "/" + key
+}
+
+func newEmptyInstance() *Instance {
+	return &Instance{
+		Aggregate: new(goes.Aggregate),
+		State:     make(map[string]string),
+		handled:   make(map[string]bool),
+		timeouts:  make(map[string]time.Time),
+	}
+}
+
+func newInstance(saga, key string) (*Instance, error) {
+	instance := newEmptyInstance()
+	instance.AggregateID = instanceID(saga, key)
+	if err := instance.apply(Started{Saga: saga, Key: key}); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+//instanceRouter routes events to the Instance event handlers.
+var instanceRouter = newInstanceRouter()
+
+func newInstanceRouter() *goes.Router[*Instance] {
+	router := goes.NewRouter[*Instance](goes.UnknownEventError)
+	goes.Handle(router, (*Instance).handleStarted)
+	goes.Handle(router, (*Instance).handleEventHandled)
+	goes.Handle(router, (*Instance).handleStateSet)
+	goes.Handle(router, (*Instance).handleCommandIssued)
+	goes.Handle(router, (*Instance).handleCommandSent)
+	goes.Handle(router, (*Instance).handleTimeoutScheduled)
+	goes.Handle(router, (*Instance).handleTimeoutCancelled)
+	goes.Handle(router, (*Instance).handleTimeoutFired)
+	goes.Handle(router, (*Instance).handleCompleted)
+	return router
+}
+
+//typeCode returns the type code of an instance event payload.
+func typeCode(payload interface{}) string {
+	switch payload.(type) {
+	case Started:
+		return StartedTypeCode
+	case EventHandled:
+		return EventHandledTypeCode
+	case StateSet:
+		return StateSetTypeCode
+	case CommandIssued:
+		return CommandIssuedTypeCode
+	case CommandSent:
+		return CommandSentTypeCode
+	case TimeoutScheduled:
+		return TimeoutScheduledTypeCode
+	case TimeoutCancelled:
+		return TimeoutCancelledTypeCode
+	case TimeoutFired:
+		return TimeoutFiredTypeCode
+	case Completed:
+		return CompletedTypeCode
+	}
+	return ""
+}
+
+//Route is the standard method for routing events to event handlers.
+func (i *Instance) Route(event goes.Event) error {
+	return instanceRouter.Route(i, event)
+}
+
+//Apply routes the event then records it in the event history.
+func (i *Instance) Apply(event goes.Event) error {
+	if err := event.InitMetadata(); err != nil {
+		return err
+	}
+	if err := i.Route(event); err != nil {
+		return err
+	}
+	i.Events = append(i.Events, event)
+	return nil
+}
+
+//apply applies a new event with the given payload to the instance.
+func (i *Instance) apply(payload interface{}) error {
+	err := i.Apply(goes.Event{
+		Source:   i.AggregateID,
+		Version:  i.Version + 1,
+		TypeCode: typeCode(payload),
+		Payload:  payload,
+	})
+	if err != nil {
+		return err
+	}
+	i.Version++
+	return nil
+}
+
+//Store stores the instance's uncommitted events.
+func (i *Instance) Store(eventStore goes.EventStore) error {
+	if err := eventStore.StoreEvents(i.Aggregate); err != nil {
+		return err
+	}
+	i.Events = nil
+	return nil
+}
+
+func (i *Instance) handleStarted(event Started) {
+	i.Saga = event.Saga
+	i.Key = event.Key
+}
+
+func (i *Instance) handleEventHandled(event EventHandled) {
+	i.handled[event.EventID] = true
+}
+
+func (i *Instance) handleStateSet(event StateSet) {
+	i.State[event.Name] = event.Value
+}
+
+func (i *Instance) handleCommandIssued(event CommandIssued) {
+	i.pending = append(i.pending, event.Command)
+}
+
+func (i *Instance) handleCommandSent(event CommandSent) {
+	for n, c := range i.pending {
+		if c.ID == event.CommandID {
+			i.pending = append(i.pending[:n:n], i.pending[n+1:]...)
+			return
+		}
+	}
+}
+
+func (i *Instance) handleTimeoutScheduled(event TimeoutScheduled) {
+	i.timeouts[event.Name] = event.Deadline
+}
+
+func (i *Instance) handleTimeoutCancelled(event TimeoutCancelled) {
+	delete(i.timeouts, event.Name)
+}
+
+func (i *Instance) handleTimeoutFired(event TimeoutFired) {
+	delete(i.timeouts, event.Name)
+}
+
+func (i *Instance) handleCompleted(event Completed) {
+	i.Completed = true
+	i.timeouts = make(map[string]time.Time)
+}
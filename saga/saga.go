@@ -0,0 +1,108 @@
+//Package saga coordinates workflows across aggregates with process managers, or sagas,
+//that react to events by sending commands.
+//
+//A Definition correlates the events it is interested in to saga instances by a key,
+//and reacts to them and to the timeouts it schedules through a Context. The state of
+//each instance is event sourced on goes.Aggregate and held in an event store, alongside
+//a record of the events it has handled, so an event delivered more than once is only
+//handled once.
+package saga
+
+import (
+	"time"
+
+	"github.com/xtracdev/goes"
+)
+
+//Definition describes a saga.
+type Definition interface {
+	//Name identifies the saga. Instance aggregate ids are derived from it, so it must
+	//be unique and stable.
+	Name() string
+	//Correlate returns the key of the saga instance the event belongs to, and whether
+	//the event starts a new instance if there is none. An empty key means the saga is
+	//not interested in the event.
+	Correlate(event goes.Event) (key string, starts bool)
+	//Handle reacts to an event correlated to the instance.
+	Handle(ctx *Context, event goes.Event) error
+	//Timeout reacts to a timeout scheduled by the instance falling due.
+	Timeout(ctx *Context, name string) error
+}
+
+//Command is a command sent by a saga instance. The ID is unique and stays the same if
+//sending the command is retried, so receivers can ignore duplicates.
+type Command struct {
+	ID      string
+	Payload interface{}
+}
+
+//CommandSender sends the commands issued by saga instances.
+type CommandSender interface {
+	Send(command Command) error
+}
+
+//SenderFunc adapts a function to the CommandSender interface.
+type SenderFunc func(command Command) error
+
+//Send calls the function.
+func (f SenderFunc) Send(command Command) error {
+	return f(command)
+}
+
+//Context is given to a Definition to read and change the state of a saga instance.
+//Changes are recorded as events on the instance, and stored once the definition
+//returns without an error; commands are sent once they are stored. A change that cannot
+//be recorded is reported as an error, which the definition should return.
+type Context struct {
+	instance *Instance
+	now      time.Time
+}
+
+//Key returns the correlation key of the instance.
+func (c *Context) Key() string {
+	return c.instance.Key
+}
+
+//Now returns the time the event or timeout is being handled.
+func (c *Context) Now() time.Time {
+	return c.now
+}
+
+//Get returns the value of a state variable of the instance.
+func (c *Context) Get(name string) string {
+	return c.instance.State[name]
+}
+
+//Set sets the value of a state variable of the instance.
+func (c *Context) Set(name, value string) error {
+	return c.instance.apply(StateSet{Name: name, Value: value})
+}
+
+//Send issues a command.
+func (c *Context) Send(payload interface{}) error {
+	id, err := goes.GenerateID()
+	if err != nil {
+		return err
+	}
+	return c.instance.apply(CommandIssued{Command: Command{ID: id, Payload: payload}})
+}
+
+//ScheduleTimeout schedules the named timeout to fall due after the given duration,
+//replacing any timeout already scheduled with the same name.
+func (c *Context) ScheduleTimeout(name string, after time.Duration) error {
+	return c.instance.apply(TimeoutScheduled{Name: name, Deadline: c.now.Add(after)})
+}
+
+//CancelTimeout cancels the named timeout.
+func (c *Context) CancelTimeout(name string) error {
+	if _, ok := c.instance.timeouts[name]; ok {
+		return c.instance.apply(TimeoutCancelled{Name: name})
+	}
+	return nil
+}
+
+//Complete ends the saga instance. Events and timeouts for a completed instance are
+//ignored.
+func (c *Context) Complete() error {
+	return c.instance.apply(Completed{})
+}
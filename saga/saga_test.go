@@ -0,0 +1,214 @@
+package saga_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/saga"
+	"github.com/xtracdev/goes/sample"
+	"github.com/xtracdev/goes/sample/testagg"
+)
+
+type CreateTestAgg struct {
+	Foo string
+}
+
+type SendReminder struct {
+	UserID string
+}
+
+//onboarding creates a TestAgg for each new user, and reminds users who have not
+//updated their first name within a day.
+type onboarding struct{}
+
+func (onboarding) Name() string {
+	return "onboarding"
+}
+
+func (onboarding) Correlate(event goes.Event) (string, bool) {
+	switch event.Payload.(type) {
+	case sample.UserCreated:
+		return event.Source, true
+	case sample.UserFirstNameUpdated:
+		return event.Source, false
+	}
+	return "", false
+}
+
+func (onboarding) Handle(ctx *saga.Context, event goes.Event) error {
+	switch payload := event.Payload.(type) {
+	case sample.UserCreated:
+		if err := ctx.Set("first", payload.FirstName); err != nil {
+			return err
+		}
+		if err := ctx.ScheduleTimeout("reminder", 24*time.Hour); err != nil {
+			return err
+		}
+		return ctx.Send(CreateTestAgg{Foo: payload.FirstName})
+	case sample.UserFirstNameUpdated:
+		if err := ctx.CancelTimeout("reminder"); err != nil {
+			return err
+		}
+		return ctx.Complete()
+	}
+	return nil
+}
+
+func (onboarding) Timeout(ctx *saga.Context, name string) error {
+	return ctx.Send(SendReminder{UserID: ctx.Key()})
+}
+
+//commandLog records the commands sent, creating a TestAgg for each CreateTestAgg.
+type commandLog struct {
+	store    goes.EventStore
+	fail     bool
+	commands []saga.Command
+}
+
+func (l *commandLog) Send(command saga.Command) error {
+	if l.fail {
+		return errors.New("send failed")
+	}
+
+	if create, ok := command.Payload.(CreateTestAgg); ok {
+		agg, err := testagg.NewTestAgg(create.Foo, "bar", "baz")
+		if err != nil {
+			return err
+		}
+		if err := agg.Store(l.store); err != nil {
+			return err
+		}
+	}
+
+	l.commands = append(l.commands, command)
+	return nil
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newUser(t *testing.T, store goes.EventStore) (*sample.User, goes.Event) {
+	user, err := sample.NewUser("joe", "bloggs", "joe@example.com")
+	assert.Nil(t, err)
+	assert.Nil(t, user.Store(store))
+
+	events, err := store.RetrieveEvents(user.AggregateID)
+	assert.Nil(t, err)
+	return user, events[0]
+}
+
+func TestSagaReactsToPublishedEvents(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	defer store.Close()
+	sender := &commandLog{store: store}
+
+	coordinator := saga.NewCoordinator(onboarding{}, store, sender)
+	coordinator.Start(store)
+	defer coordinator.Stop()
+
+	_, created := newUser(t, store)
+	store.Drain()
+	assert.Nil(t, coordinator.Err())
+
+	if assert.Equal(t, 1, len(sender.commands)) {
+		assert.Equal(t, CreateTestAgg{Foo: "joe"}, sender.commands[0].Payload)
+	}
+
+	//A redelivered event is handled once
+	assert.Nil(t, coordinator.Handle(created))
+	assert.Equal(t, 1, len(sender.commands))
+
+	instance, err := store.RetrieveEvents("onboarding/" + created.Source)
+	assert.Nil(t, err)
+	assert.Equal(t, saga.StartedTypeCode, instance[0].TypeCode)
+}
+
+func TestSagaStoresInstancesInTheStoreItWatches(t *testing.T) {
+	//With a queue of one the coordinator's own writes find its queue full
+	store := inmemes.NewInMemoryEventStoreWithConfig(inmemes.DeliveryConfig{QueueSize: 1})
+	defer store.Close()
+	sender := &commandLog{store: store}
+
+	coordinator := saga.NewCoordinator(onboarding{}, store, sender)
+	coordinator.Start(store)
+	defer coordinator.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			newUser(t, store)
+		}
+		store.Drain()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("saga writing to the store it watches did not finish")
+	}
+
+	assert.Nil(t, coordinator.Err())
+	assert.Equal(t, 3, len(sender.commands))
+}
+
+func TestSagaTimeouts(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	sender := &commandLog{store: store}
+	c := &clock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	coordinator := saga.NewCoordinator(onboarding{}, store, sender).WithClock(c.Now)
+
+	_, forgetful := newUser(t, store)
+	assert.Nil(t, coordinator.Handle(forgetful))
+
+	prompt, created := newUser(t, store)
+	assert.Nil(t, coordinator.Handle(created))
+	assert.Nil(t, prompt.UpdateFirstName("joseph"))
+	assert.Nil(t, prompt.Store(store))
+	events, err := store.RetrieveEvents(prompt.AggregateID)
+	assert.Nil(t, err)
+	assert.Nil(t, coordinator.Handle(events[1]))
+
+	c.now = c.now.Add(23 * time.Hour)
+	assert.Nil(t, coordinator.FireTimeouts())
+	assert.Equal(t, 2, len(sender.commands))
+
+	c.now = c.now.Add(2 * time.Hour)
+	assert.Nil(t, coordinator.FireTimeouts())
+	assert.Nil(t, coordinator.FireTimeouts())
+	if assert.Equal(t, 3, len(sender.commands)) {
+		assert.Equal(t, SendReminder{UserID: forgetful.Source}, sender.commands[2].Payload)
+	}
+}
+
+func TestUnsentCommandsAreResumed(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	sender := &commandLog{store: store, fail: true}
+	c := &clock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	_, created := newUser(t, store)
+	assert.NotNil(t, saga.NewCoordinator(onboarding{}, store, sender).WithClock(c.Now).Handle(created))
+	assert.Equal(t, 0, len(sender.commands))
+
+	//After a restart the command is sent and the timeout is still scheduled
+	sender.fail = false
+	restarted := saga.NewCoordinator(onboarding{}, store, sender).WithClock(c.Now)
+	assert.Nil(t, restarted.Resume(store))
+	assert.Equal(t, 1, len(sender.commands))
+
+	c.now = c.now.Add(25 * time.Hour)
+	assert.Nil(t, restarted.FireTimeouts())
+	assert.Equal(t, 2, len(sender.commands))
+
+	assert.Nil(t, restarted.Handle(created))
+	assert.Equal(t, 2, len(sender.commands))
+}
@@ -0,0 +1,47 @@
+package sample
+
+import (
+	"errors"
+
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/command"
+)
+
+//UpdateFirstNameCommand requests a change to a user's first name. The RequestID is
+//supplied by the client, so a retried request does not update the name twice.
+type UpdateFirstNameCommand struct {
+	UserID    string
+	FirstName string
+	RequestID string
+}
+
+//CommandName names the command.
+func (c UpdateFirstNameCommand) CommandName() string {
+	return "UpdateFirstName"
+}
+
+//Validate checks the command identifies a user and a new name.
+func (c UpdateFirstNameCommand) Validate() error {
+	if c.UserID == "" {
+		return errors.New("No user id")
+	}
+	if c.FirstName == "" {
+		return errors.New("No first name")
+	}
+	return nil
+}
+
+//IdempotencyKey returns the request id.
+func (c UpdateFirstNameCommand) IdempotencyKey() string {
+	return c.RequestID
+}
+
+//RegisterUserCommands registers handlers for the User commands with the bus, running
+//each command against the user loaded from the repository.
+func RegisterUserCommands(bus *command.Bus, repo *goes.Repository[*User]) {
+	command.Handle(bus, func(c UpdateFirstNameCommand) error {
+		return repo.Update(c.UserID, func(u *User) error {
+			return u.UpdateFirstName(c.FirstName)
+		})
+	})
+}
@@ -1,14 +1,17 @@
 package testagg
 
 import (
-	"errors"
+	"encoding/json"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/golang/protobuf/proto"
 	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/protocodec"
 )
 
-var ErrUnknownType = errors.New("Unknown event type")
+//ErrUnknownType is wrapped by the errors returned when marshalling or unmarshalling an
+//event of a type the aggregate does not know.
+var ErrUnknownType = goes.ErrUnknownEventType
 
 //The constants are used as unmarshalling hints when reconstructing the
 //aggregate from its event history
@@ -17,6 +20,15 @@ const (
 	TestAggFooUpdateTypeCode = "TAFU"
 )
 
+//Codecs maps the TestAgg event type codes to their protobuf payload types, and is
+//used to marshall and unmarshall the events when they are stored and retrieved.
+var Codecs = goes.NewTypeRegistry()
+
+func init() {
+	Codecs.MustRegister(TestAggCreatedTypeCode, TestAggCreated{}, protocodec.Codec{})
+	Codecs.MustRegister(TestAggFooUpdateTypeCode, TestAggFooUpdated{}, protocodec.Codec{})
+}
+
 //The aggregate for our example. In addition to the aggregate type, we need to capture
 //the commands associated with the aggregate (implemented as exported methods that route
 //events) and event types that are used to apply the state mutations.
@@ -27,6 +39,14 @@ type TestAgg struct {
 	Baz string
 }
 
+//testAggState is the serialized form of the aggregate state held in a snapshot.
+type testAggState struct {
+	AggregateID string
+	Foo         string
+	Bar         string
+	Baz         string
+}
+
 //Factory method for instantiating the aggregate, which is also the command method for 'create'
 func NewTestAgg(foo, bar, baz string) (*TestAgg, error) {
 	//Do validation... return an error if there's a problem
@@ -45,12 +65,15 @@ func NewTestAgg(foo, bar, baz string) (*TestAgg, error) {
 		Baz:         baz,
 	}
 
-	testAgg.Apply(
+	err = testAgg.Apply(
 		goes.Event{
 			Source:  testAgg.AggregateID,
 			Version: testAgg.Version,
 			Payload: testAggCreated,
 		})
+	if err != nil {
+		return nil, err
+	}
 
 	return testAgg, nil
 }
@@ -65,24 +88,63 @@ func NewTestAggFromHistory(events []goes.Event) *TestAgg {
 	agg, _ := goes.NewAggregate()
 	testAgg.Aggregate = agg
 
-	unmarshalledEvents, err := unmarshallEvents(events)
-	if err != nil {
+	if err := testAgg.applyHistory(events); err != nil {
 		return nil
 	}
 
+	return testAgg
+}
+
+//Factory method for recreating the aggregate state from a snapshot and the events stored
+//after the snapshot was taken. Events at or below the snapshot version are ignored.
+func NewTestAggFromSnapshot(snapshot goes.Snapshot, events []goes.Event) (*TestAgg, error) {
+	testAgg := &TestAgg{Aggregate: new(goes.Aggregate)}
+	if err := testAgg.RestoreSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	if err := testAgg.applyHistory(goes.EventsAfter(events, snapshot.Version)); err != nil {
+		return nil, err
+	}
+
+	return testAgg, nil
+}
+
+//NewTestAggRepository returns a repository for loading and saving TestAgg aggregates
+//using the given event store.
+func NewTestAggRepository(eventStore goes.EventStore) *goes.Repository[*TestAgg] {
+	return goes.NewRepository(eventStore, func() *TestAgg {
+		return &TestAgg{Aggregate: new(goes.Aggregate)}
+	}).WithCodec(Codecs)
+}
+
+//LoadTestAgg loads the aggregate from the event store, starting from the latest snapshot
+//in the snapshot store if there is one.
+func LoadTestAgg(eventStore goes.EventStore, snapshotStore goes.SnapshotStore, aggregateID string) (*TestAgg, error) {
+	return NewTestAggRepository(eventStore).WithSnapshots(snapshotStore, nil).Load(aggregateID)
+}
+
+func (ta *TestAgg) applyHistory(events []goes.Event) error {
+	unmarshalledEvents, err := goes.DecodeEvents(Codecs, events)
+	if err != nil {
+		return err
+	}
+
 	for _, e := range unmarshalledEvents {
 		log.Debug("apply event", e)
-		testAgg.Version += 1
-		testAgg.Route(e)
+		ta.Version += 1
+		if err := ta.Route(e); err != nil {
+			return err
+		}
 	}
 
-	return testAgg
+	return nil
 }
 
 //Command method for updating the foo attribute
-func (ta *TestAgg) UpdateFoo(newfoo string) {
+func (ta *TestAgg) UpdateFoo(newfoo string) error {
 	ta.Version += 1
-	ta.Apply(
+	return ta.Apply(
 		goes.Event{
 			Source:  ta.AggregateID,
 			Version: ta.Version,
@@ -93,43 +155,47 @@ func (ta *TestAgg) UpdateFoo(newfoo string) {
 		})
 }
 
-//The required apply method, called only from commands to route and record events
-func (ta *TestAgg) Apply(event goes.Event) {
-	ta.Route(event)
+//The required apply method, called only from commands to route and record events. The
+//event metadata is filled in before the event is recorded.
+func (ta *TestAgg) Apply(event goes.Event) error {
+	if err := event.InitMetadata(); err != nil {
+		return err
+	}
+	if err := ta.Route(event); err != nil {
+		return err
+	}
 	ta.Events = append(ta.Events, event)
+	return nil
 }
 
+//testAggRouter routes events to the On<EventType> handler methods of TestAgg.
+var testAggRouter = goes.NewRouter[*TestAgg](goes.UnknownEventError).RegisterMethods()
+
 //The required route method to route events to their handlers. Note the handlers may
 //only change state - no other side effects are allowed.
-func (ta *TestAgg) Route(event goes.Event) {
-	event.Version = ta.Version
-	switch event.Payload.(type) {
-	case TestAggCreated:
-		ta.handleTestAggCreated(event.Payload.(TestAggCreated))
-	case TestAggFooUpdated:
-		ta.handleTestFooUpdate(event.Payload.(TestAggFooUpdated))
-	default:
-		panic("WARN: unknown event routed to User aggregate")
-	}
+func (ta *TestAgg) Route(event goes.Event) error {
+	return testAggRouter.Route(ta, event)
 }
 
-func (ta *TestAgg) handleTestAggCreated(event TestAggCreated) {
+//OnTestAggCreated handles the TestAggCreated event.
+func (ta *TestAgg) OnTestAggCreated(event TestAggCreated) {
 	ta.AggregateID = event.AggregateId
 	ta.Foo = event.Foo
 	ta.Bar = event.Bar
 	ta.Baz = event.Baz
 }
 
-func (ta *TestAgg) handleTestFooUpdate(event TestAggFooUpdated) {
+//OnTestAggFooUpdated handles the TestAggFooUpdated event.
+func (ta *TestAgg) OnTestAggFooUpdated(event TestAggFooUpdated) {
 	ta.Foo = event.NewFoo
 }
 
 //Required implementation of the Store method.
 func (ta *TestAgg) Store(eventStore goes.EventStore) error {
 
-	marshalled, err := marshallEvents(ta.Events)
+	marshalled, err := goes.EncodeEvents(Codecs, ta.Events)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	log.Debug("Storing ", len(ta.Events), " events.")
@@ -150,86 +216,44 @@ func (ta *TestAgg) Store(eventStore goes.EventStore) error {
 	return nil
 }
 
-func marshallCreate(create TestAggCreated) ([]byte, error) {
-	return proto.Marshal(&create)
-}
-
-func marshallFooUpdated(event TestAggFooUpdated) ([]byte, error) {
-	return proto.Marshal(&event)
-}
-
-func unmarshallCreated(bytes []byte) (TestAggCreated, error) {
-	var payload TestAggCreated
-	err := proto.Unmarshal(bytes, &payload)
-	return payload, err
-}
-
-func unmarshallFooUpdated(bytes []byte) (TestAggFooUpdated, error) {
-	var payload TestAggFooUpdated
-	err := proto.Unmarshal(bytes, &payload)
-	return payload, err
-}
-
-func unmarshallEvents(events []goes.Event) ([]goes.Event, error) {
-	var unmarshalled []goes.Event
-
-	for _, e := range events {
-
-		var err error
-		var newEvent goes.Event
-		newEvent.Source = e.Source
-		newEvent.Version = e.Version
-		newEvent.TypeCode = e.TypeCode
-
-		switch e.TypeCode {
-		case TestAggCreatedTypeCode:
-			newEvent.Payload, err = unmarshallCreated(e.Payload.([]byte))
-			if err != nil {
-				return nil, err
-			}
-		case TestAggFooUpdateTypeCode:
-			newEvent.Payload, err = unmarshallFooUpdated(e.Payload.([]byte))
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		unmarshalled = append(unmarshalled, newEvent)
+//Snapshot captures the current state of the aggregate as a snapshot at the current version.
+func (ta *TestAgg) Snapshot() (goes.Snapshot, error) {
+	state, err := json.Marshal(testAggState{
+		AggregateID: ta.AggregateID,
+		Foo:         ta.Foo,
+		Bar:         ta.Bar,
+		Baz:         ta.Baz,
+	})
+	if err != nil {
+		return goes.Snapshot{}, err
 	}
 
-	return unmarshalled, nil
+	return goes.Snapshot{
+		AggregateID: ta.AggregateID,
+		Version:     ta.Version,
+		State:       state,
+		Timestamp:   time.Now().UTC(),
+	}, nil
 }
 
-func marshallEvents(events []goes.Event) ([]goes.Event, error) {
-
-	var updatedEvents []goes.Event
-
-	for _, e := range events {
-
-		var err error
-		var newEvent goes.Event
-		newEvent.Source = e.Source
-		newEvent.Version = e.Version
+//RestoreSnapshot restores the aggregate state captured in the snapshot.
+func (ta *TestAgg) RestoreSnapshot(snapshot goes.Snapshot) error {
+	var state testAggState
+	if err := json.Unmarshal(snapshot.State, &state); err != nil {
+		return err
+	}
 
-		switch e.Payload.(type) {
-		case TestAggCreated:
-			newEvent.TypeCode = TestAggCreatedTypeCode
-			newEvent.Payload, err = marshallCreate(e.Payload.(TestAggCreated))
-			if err != nil {
-				return nil, err
-			}
-		case TestAggFooUpdated:
-			newEvent.TypeCode = TestAggFooUpdateTypeCode
-			newEvent.Payload, err = marshallFooUpdated(e.Payload.(TestAggFooUpdated))
-			if err != nil {
-				return nil, err
-			}
-		default:
-			return nil, ErrUnknownType
-		}
+	ta.AggregateID = state.AggregateID
+	ta.Version = snapshot.Version
+	ta.Foo = state.Foo
+	ta.Bar = state.Bar
+	ta.Baz = state.Baz
 
-		updatedEvents = append(updatedEvents, newEvent)
-	}
+	return nil
+}
 
-	return updatedEvents, nil
+//StoreWithSnapshot stores the aggregate's uncommitted events, then saves a snapshot of the
+//aggregate if the snapshot policy calls for one.
+func (ta *TestAgg) StoreWithSnapshot(eventStore goes.EventStore, snapshotStore goes.SnapshotStore, policy goes.SnapshotPolicy) error {
+	return NewTestAggRepository(eventStore).WithSnapshots(snapshotStore, policy).Save(ta)
 }
@@ -34,7 +34,7 @@ func NewUser(first, last, email string) (*User, error) {
 	user.Aggregate = agg
 
 	user.Version = 1
-	user.Apply(
+	err = user.Apply(
 		goes.Event{
 			Source:  user.AggregateID,
 			Version: user.Version,
@@ -45,12 +45,16 @@ func NewUser(first, last, email string) (*User, error) {
 				Email:       email,
 			},
 		})
+	if err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
 
 //NewUserFromHistory instantiates a User and applies its event history to derive the current
-//state of hte aggregate.
+//state of hte aggregate. Nil is returned if the history contains an event the User
+//cannot handle.
 func NewUserFromHistory(events []goes.Event) *User {
 	user := new(User)
 	agg, _ := goes.NewAggregate()
@@ -59,12 +63,48 @@ func NewUserFromHistory(events []goes.Event) *User {
 	for _, e := range events {
 		log.Println("apply event", e)
 		user.Version++
-		user.Route(e)
+		if err := user.Route(e); err != nil {
+			log.Println("unable to apply event", err)
+			return nil
+		}
 	}
 
 	return user
 }
 
+//Type codes identifying the User events when they are serialized.
+const (
+	UserCreatedTypeCode          = "UCRE"
+	UserFirstNameUpdatedTypeCode = "UFNU"
+	UserLastNameUpdatedTypeCode  = "ULNU"
+)
+
+//Codecs maps the User event type codes to their payload types, serialized as JSON.
+var Codecs = goes.NewTypeRegistry()
+
+func init() {
+	Codecs.MustRegister(UserCreatedTypeCode, UserCreated{}, goes.JSONCodec{})
+	Codecs.MustRegister(UserFirstNameUpdatedTypeCode, UserFirstNameUpdated{}, goes.JSONCodec{})
+	Codecs.MustRegister(UserLastNameUpdatedTypeCode, UserLastNameUpdated{}, goes.JSONCodec{})
+}
+
+//NewUserRepository returns a repository for loading and saving User aggregates
+//using the given event store. Events are serialized as JSON using Codecs.
+func NewUserRepository(eventStore goes.EventStore) *goes.Repository[*User] {
+	return goes.NewRepository(eventStore, func() *User {
+		return &User{Aggregate: new(goes.Aggregate)}
+	}).WithCodec(Codecs).WithClone((*User).Clone)
+}
+
+//Clone returns a copy of the user, with its own copy of the embedded aggregate.
+func (u *User) Clone() *User {
+	clone := *u
+	aggregate := *u.Aggregate
+	aggregate.Events = append([]goes.Event(nil), u.Events...)
+	clone.Aggregate = &aggregate
+	return &clone
+}
+
 //UserCreated is the event generated when a user struct is first instantiated.
 type UserCreated struct {
 	AggregateId string
@@ -87,9 +127,9 @@ type UserLastNameUpdated struct {
 
 //UpdateFirstName is a command handler that handles updating the user first name,
 //generating a UserFirstNameUpdated event.
-func (u *User) UpdateFirstName(first string) {
+func (u *User) UpdateFirstName(first string) error {
 	u.Version++
-	u.Apply(
+	return u.Apply(
 		goes.Event{
 			Source:  u.AggregateID,
 			Version: u.Version,
@@ -100,6 +140,21 @@ func (u *User) UpdateFirstName(first string) {
 		})
 }
 
+//UpdateLastName is a command handler that handles updating the user last name,
+//generating a UserLastNameUpdated event.
+func (u *User) UpdateLastName(last string) error {
+	u.Version++
+	return u.Apply(
+		goes.Event{
+			Source:  u.AggregateID,
+			Version: u.Version,
+			Payload: UserLastNameUpdated{
+				OldLast: u.LastName,
+				NewLast: last,
+			},
+		})
+}
+
 func (u *User) handleUserCreated(event UserCreated) {
 	u.Aggregate.AggregateID = event.AggregateId
 	u.FirstName = event.FirstName
@@ -111,24 +166,38 @@ func (u *User) handleUserFirstNameUpdate(event UserFirstNameUpdated) {
 	u.FirstName = event.NewFirst
 }
 
+func (u *User) handleUserLastNameUpdate(event UserLastNameUpdated) {
+	u.LastName = event.NewLast
+}
+
+//userRouter routes events to the User event handlers.
+var userRouter = newUserRouter()
+
+func newUserRouter() *goes.Router[*User] {
+	router := goes.NewRouter[*User](goes.UnknownEventError)
+	goes.Handle(router, (*User).handleUserCreated)
+	goes.Handle(router, (*User).handleUserFirstNameUpdate)
+	goes.Handle(router, (*User).handleUserLastNameUpdate)
+	return router
+}
+
 //Route is the standard method for routing events to event handlers.
-func (u *User) Route(event goes.Event) {
-	event.Version = u.Version
-	switch event.Payload.(type) {
-	case UserCreated:
-		u.handleUserCreated(event.Payload.(UserCreated))
-	case UserFirstNameUpdated:
-		u.handleUserFirstNameUpdate(event.Payload.(UserFirstNameUpdated))
-	default:
-		panic("WARN: unknown event routed to User aggregate")
-	}
+func (u *User) Route(event goes.Event) error {
+	return userRouter.Route(u, event)
 }
 
 //Apply is the standard event sourcing method that routes an event then records
-//the event in the event history
-func (u *User) Apply(event goes.Event) {
-	u.Route(event)
+//the event in the event history. The event metadata (ID, timestamp and correlation)
+//is filled in before the event is recorded.
+func (u *User) Apply(event goes.Event) error {
+	if err := event.InitMetadata(); err != nil {
+		return err
+	}
+	if err := u.Route(event); err != nil {
+		return err
+	}
 	u.Events = append(u.Events, event)
+	return nil
 }
 
 //Store uses the event store passed to it to persistently recorded
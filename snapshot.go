@@ -0,0 +1,48 @@
+package goes
+
+import "time"
+
+//Snapshot holds the serialized state of an aggregate as of a given version. When
+//loading an aggregate, the state is restored from the snapshot and only the events
+//with a version greater than the snapshot version are applied.
+type Snapshot struct {
+	AggregateID string
+	Version     int
+	State       []byte
+	Timestamp   time.Time
+}
+
+//SnapshotStore defines the methods offered by a snapshot store. LoadSnapshot returns
+//the most recent snapshot saved for the aggregate, or nil if there is none.
+type SnapshotStore interface {
+	SaveSnapshot(Snapshot) error
+	LoadSnapshot(aggregateID string) (*Snapshot, error)
+}
+
+//SnapshotPolicy decides whether a new snapshot should be taken for an aggregate
+//at currentVersion, given the version of its last snapshot.
+type SnapshotPolicy interface {
+	ShouldSnapshot(lastSnapshotVersion, currentVersion int) bool
+}
+
+//EveryNEvents is a SnapshotPolicy that takes a snapshot once at least N events have
+//been stored since the last snapshot. A value less than 1 never takes snapshots.
+type EveryNEvents int
+
+//ShouldSnapshot returns true if N or more events have been stored since the last
+//snapshot.
+func (n EveryNEvents) ShouldSnapshot(lastSnapshotVersion, currentVersion int) bool {
+	return n > 0 && currentVersion-lastSnapshotVersion >= int(n)
+}
+
+//EventsAfter returns the events with a version greater than version, for applying
+//on top of a snapshot taken at that version.
+func EventsAfter(events []Event, version int) []Event {
+	var after []Event
+	for _, e := range events {
+		if e.Version > version {
+			after = append(after, e)
+		}
+	}
+	return after
+}
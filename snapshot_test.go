@@ -0,0 +1,28 @@
+package goes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryNEvents(t *testing.T) {
+	policy := EveryNEvents(3)
+	assert.False(t, policy.ShouldSnapshot(0, 2))
+	assert.True(t, policy.ShouldSnapshot(0, 3))
+	assert.True(t, policy.ShouldSnapshot(3, 7))
+	assert.False(t, policy.ShouldSnapshot(6, 7))
+
+	assert.False(t, EveryNEvents(0).ShouldSnapshot(0, 100))
+}
+
+func TestEventsAfter(t *testing.T) {
+	events := []Event{{Version: 1}, {Version: 2}, {Version: 3}}
+	after := EventsAfter(events, 1)
+	if assert.Equal(t, 2, len(after)) {
+		assert.Equal(t, 2, after[0].Version)
+		assert.Equal(t, 3, after[1].Version)
+	}
+
+	assert.Empty(t, EventsAfter(events, 3))
+}
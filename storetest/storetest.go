@@ -0,0 +1,499 @@
+//Package storetest provides a conformance test suite for EventStore implementations.
+//
+//A store implementation proves it follows the EventStore contract by calling Run from
+//one of its tests with a factory that creates an empty store:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) goes.EventStore {
+//			return mystore.New().WithCodec(storetest.Codecs)
+//		})
+//	}
+//
+//The publishing tests are run when the store also implements EventPublisher and
+//EventRepublisher, and the expected version, batch and global log tests when it
+//implements ExpectedVersionStore, BatchStore and EventLogReader.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+)
+
+//deliveryTimeout is how long to wait for published events to be delivered.
+const deliveryTimeout = 5 * time.Second
+
+//TestEvent is the payload of the events stored by the conformance tests.
+type TestEvent struct {
+	Name string
+}
+
+//TestEventTypeCode is the type code of TestEvent.
+const TestEventTypeCode = "STTE"
+
+//Codecs serializes the TestEvent payloads as JSON, for stores that hold serialized
+//payloads.
+var Codecs = goes.NewTypeRegistry()
+
+func init() {
+	Codecs.MustRegister(TestEventTypeCode, TestEvent{}, goes.JSONCodec{})
+}
+
+//Factory creates a new, empty event store for a test. Stores that implement io.Closer
+//are closed when the test finishes.
+type Factory func(t *testing.T) goes.EventStore
+
+//drainer is implemented by stores that deliver events asynchronously and can wait for
+//the events published so far to be delivered.
+type drainer interface {
+	Drain()
+}
+
+//Run runs the conformance tests against stores created by the factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, goes.EventStore)
+	}{
+		{"AppendAndRetrieve", testAppendAndRetrieve},
+		{"UnknownAggregate", testUnknownAggregate},
+		{"VersionIsolation", testVersionIsolation},
+		{"ConcurrencyConflict", testConcurrencyConflict},
+		{"ExpectedVersion", testExpectedVersion},
+		{"Batch", testBatch},
+		{"EventLog", testEventLog},
+		{"PublishOnStore", testPublishOnStore},
+		{"Unsubscribe", testUnsubscribe},
+		{"Republish", testRepublish},
+		{"WriteFromSubscriber", testWriteFromSubscriber},
+		{"Ordering", testOrdering},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := factory(t)
+			if closer, ok := store.(io.Closer); ok {
+				t.Cleanup(func() { closer.Close() })
+			}
+			tc.test(t, store)
+		})
+	}
+}
+
+//newAggregate returns an aggregate with a new event for each of the names.
+func newAggregate(t *testing.T, names ...string) *goes.Aggregate {
+	agg, err := goes.NewAggregate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEvents(agg, names...)
+	return agg
+}
+
+//addEvents adds a new event to the aggregate for each of the names.
+func addEvents(agg *goes.Aggregate, names ...string) {
+	for _, name := range names {
+		agg.Version++
+		agg.Events = append(agg.Events, goes.Event{
+			Source:   agg.AggregateID,
+			Version:  agg.Version,
+			TypeCode: TestEventTypeCode,
+			Payload:  TestEvent{Name: name},
+		})
+	}
+}
+
+//storeEvents stores the aggregate's events, then clears them as an aggregate does once
+//its events are stored.
+func storeEvents(t *testing.T, store goes.EventStore, agg *goes.Aggregate) {
+	if err := store.StoreEvents(agg); err != nil {
+		t.Fatalf("Storing events for %s: %v", agg.AggregateID, err)
+	}
+	agg.Events = nil
+}
+
+//names returns the names carried by the events.
+func names(events []goes.Event) []string {
+	var names []string
+	for _, e := range events {
+		if payload, ok := e.Payload.(TestEvent); ok {
+			names = append(names, payload.Name)
+		} else {
+			names = append(names, fmt.Sprintf("%T", e.Payload))
+		}
+	}
+	return names
+}
+
+func publisherFor(t *testing.T, store goes.EventStore) goes.EventPublisher {
+	publisher, ok := store.(goes.EventPublisher)
+	if !ok {
+		t.Skip("Store does not implement EventPublisher")
+	}
+	return publisher
+}
+
+//recorder collects the events delivered to a subscriber.
+type recorder struct {
+	sync.Mutex
+	events []goes.Event
+}
+
+func (r *recorder) callback(e goes.Event) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) received() []goes.Event {
+	r.Lock()
+	defer r.Unlock()
+	return append([]goes.Event(nil), r.events...)
+}
+
+//waitForEvents waits until the recorder has received count events, returning the
+//events received.
+func waitForEvents(t *testing.T, store goes.EventStore, r *recorder, count int) []goes.Event {
+	settle(store)
+
+	deadline := time.Now().Add(deliveryTimeout)
+	for len(r.received()) < count && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return r.received()
+}
+
+//settle gives the store a chance to deliver the events published so far.
+func settle(store goes.EventStore) {
+	if d, ok := store.(drainer); ok {
+		d.Drain()
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
+func testAppendAndRetrieve(t *testing.T, store goes.EventStore) {
+	agg := newAggregate(t, "one", "two", "three")
+	storeEvents(t, store, agg)
+
+	events, err := store.RetrieveEvents(agg.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two", "three"}, names(events))
+	for i, e := range events {
+		assert.Equal(t, agg.AggregateID, e.Source)
+		assert.Equal(t, i+1, e.Version)
+		assert.Equal(t, TestEventTypeCode, e.TypeCode)
+	}
+
+	addEvents(agg, "four", "five")
+	storeEvents(t, store, agg)
+
+	events, err = store.RetrieveEvents(agg.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two", "three", "four", "five"}, names(events))
+}
+
+func testUnknownAggregate(t *testing.T, store goes.EventStore) {
+	_, err := store.RetrieveEvents("no-such-aggregate")
+	assert.True(t, errors.Is(err, goes.ErrAggregateNotFound), "Expected ErrAggregateNotFound, got %v", err)
+}
+
+func testVersionIsolation(t *testing.T, store goes.EventStore) {
+	first := newAggregate(t, "a1", "a2", "a3")
+	second := newAggregate(t, "b1")
+	storeEvents(t, store, first)
+	storeEvents(t, store, second)
+
+	//Each aggregate is versioned on its own
+	addEvents(second, "b2")
+	storeEvents(t, store, second)
+
+	events, err := store.RetrieveEvents(first.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, names(events))
+
+	events, err = store.RetrieveEvents(second.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b1", "b2"}, names(events))
+	if assert.Equal(t, 2, len(events)) {
+		assert.Equal(t, 2, events[1].Version)
+	}
+}
+
+func testConcurrencyConflict(t *testing.T, store goes.EventStore) {
+	agg := newAggregate(t, "one")
+	storeEvents(t, store, agg)
+
+	stale := &goes.Aggregate{AggregateID: agg.AggregateID, Version: agg.Version}
+	addEvents(agg, "two")
+	storeEvents(t, store, agg)
+
+	addEvents(stale, "stale")
+	err := store.StoreEvents(stale)
+	assert.True(t, errors.Is(err, goes.ErrConcurrency), "Expected ErrConcurrency, got %v", err)
+
+	var concurrencyErr *goes.ConcurrencyError
+	if assert.True(t, errors.As(err, &concurrencyErr)) {
+		assert.Equal(t, agg.AggregateID, concurrencyErr.AggregateID)
+		assert.Equal(t, 2, concurrencyErr.ActualVersion)
+	}
+
+	events, err := store.RetrieveEvents(agg.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two"}, names(events))
+}
+
+func testExpectedVersion(t *testing.T, store goes.EventStore) {
+	evStore, ok := store.(goes.ExpectedVersionStore)
+	if !ok {
+		t.Skip("Store does not implement ExpectedVersionStore")
+	}
+
+	agg := newAggregate(t, "one")
+	assert.Nil(t, evStore.StoreEventsExpecting(agg, goes.ExpectNoStream))
+	agg.Events = nil
+
+	again := &goes.Aggregate{AggregateID: agg.AggregateID}
+	addEvents(again, "again")
+	err := evStore.StoreEventsExpecting(again, goes.ExpectNoStream)
+	assert.True(t, errors.Is(err, goes.ErrConcurrency), "Expected ErrConcurrency, got %v", err)
+
+	addEvents(agg, "two")
+	assert.Nil(t, evStore.StoreEventsExpecting(agg, goes.ExpectVersion(1)))
+
+	stale := &goes.Aggregate{AggregateID: agg.AggregateID}
+	addEvents(stale, "stale")
+	assert.Nil(t, evStore.StoreEventsExpecting(stale, goes.ExpectAny))
+	assert.Equal(t, 3, stale.Version)
+
+	events, err := store.RetrieveEvents(agg.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two", "stale"}, names(events))
+}
+
+func testBatch(t *testing.T, store goes.EventStore) {
+	batchStore, ok := store.(goes.BatchStore)
+	if !ok {
+		t.Skip("Store does not implement BatchStore")
+	}
+
+	var r recorder
+	if publisher, ok := store.(goes.EventPublisher); ok {
+		publisher.SubscribeEvents(r.callback)
+	}
+
+	first := newAggregate(t, "a1", "a2")
+	second := newAggregate(t, "b1")
+	assert.Nil(t, batchStore.StoreBatch(first, second))
+	first.Events, second.Events = nil, nil
+
+	events, err := store.RetrieveEvents(second.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b1"}, names(events))
+
+	//Nothing is stored if any aggregate fails its concurrency check
+	stale := &goes.Aggregate{AggregateID: second.AggregateID}
+	addEvents(first, "a3")
+	addEvents(stale, "stale")
+	err = batchStore.StoreBatch(first, stale)
+	assert.True(t, errors.Is(err, goes.ErrConcurrency), "Expected ErrConcurrency, got %v", err)
+
+	events, err = store.RetrieveEvents(first.AggregateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a1", "a2"}, names(events))
+
+	err = batchStore.StoreBatch(first, first)
+	assert.True(t, errors.Is(err, goes.ErrDuplicateAggregate), "Expected ErrDuplicateAggregate, got %v", err)
+
+	if _, ok := store.(goes.EventPublisher); ok {
+		settle(store)
+		assert.Equal(t, []string{"a1", "a2", "b1"}, names(r.received()))
+	}
+}
+
+func testEventLog(t *testing.T, store goes.EventStore) {
+	logReader, ok := store.(goes.EventLogReader)
+	if !ok {
+		t.Skip("Store does not implement EventLogReader")
+	}
+
+	first := newAggregate(t, "a1", "a2")
+	second := newAggregate(t, "b1")
+	storeEvents(t, store, first)
+	storeEvents(t, store, second)
+	addEvents(first, "a3")
+	storeEvents(t, store, first)
+
+	head, err := logReader.HeadPosition()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), head)
+
+	var read []goes.Event
+	for position := int64(1); ; {
+		page, err := logReader.ReadEventLog(position, 3)
+		assert.Nil(t, err)
+		if len(page) == 0 {
+			break
+		}
+		read = append(read, page...)
+		position = page[len(page)-1].Position + 1
+	}
+
+	assert.Equal(t, []string{"a1", "a2", "b1", "a3"}, names(read))
+	for i, e := range read {
+		assert.Equal(t, int64(i+1), e.Position)
+	}
+}
+
+func testPublishOnStore(t *testing.T, store goes.EventStore) {
+	publisher := publisherFor(t, store)
+
+	var r recorder
+	publisher.SubscribeEvents(r.callback)
+
+	agg := newAggregate(t, "one", "two")
+	storeEvents(t, store, agg)
+
+	published := waitForEvents(t, store, &r, 2)
+	assert.Equal(t, []string{"one", "two"}, names(published))
+	for _, e := range published {
+		assert.Equal(t, agg.AggregateID, e.Source)
+	}
+}
+
+func testUnsubscribe(t *testing.T, store goes.EventStore) {
+	publisher := publisherFor(t, store)
+
+	var kept, removed recorder
+	publisher.SubscribeEvents(kept.callback)
+	id := publisher.SubscribeEvents(removed.callback)
+
+	storeEvents(t, store, newAggregate(t, "before"))
+	waitForEvents(t, store, &removed, 1)
+	publisher.Unsubscribe(id)
+
+	storeEvents(t, store, newAggregate(t, "after"))
+	assert.Equal(t, []string{"before", "after"}, names(waitForEvents(t, store, &kept, 2)))
+
+	settle(store)
+	assert.Equal(t, []string{"before"}, names(removed.received()))
+}
+
+func testRepublish(t *testing.T, store goes.EventStore) {
+	publisher := publisherFor(t, store)
+	republisher, ok := store.(goes.EventRepublisher)
+	if !ok {
+		t.Skip("Store does not implement EventRepublisher")
+	}
+
+	first := newAggregate(t, "a1")
+	second := newAggregate(t, "b1")
+	storeEvents(t, store, first)
+	storeEvents(t, store, second)
+	addEvents(first, "a2")
+	storeEvents(t, store, first)
+
+	var r recorder
+	publisher.SubscribeEvents(r.callback)
+	assert.Nil(t, republisher.RepublishAllEvents())
+
+	assert.Equal(t, []string{"a1", "b1", "a2"}, names(waitForEvents(t, store, &r, 3)))
+}
+
+func testWriteFromSubscriber(t *testing.T, store goes.EventStore) {
+	publisher := publisherFor(t, store)
+
+	//The subscriber stores a reply to the first event while the second is still queued
+	//for it, as a saga storing its state in the store it follows does
+	reply := newAggregate(t)
+	stored := make(chan error, 1)
+	var r recorder
+	publisher.SubscribeEvents(func(e goes.Event) {
+		r.callback(e)
+		if payload, ok := e.Payload.(TestEvent); ok && payload.Name == "request" {
+			addEvents(reply, "reply")
+			stored <- store.StoreEvents(reply)
+		}
+	})
+
+	storeEvents(t, store, newAggregate(t, "request", "follow up"))
+
+	select {
+	case err := <-stored:
+		assert.Nil(t, err)
+	case <-time.After(deliveryTimeout):
+		t.Fatal("Store did not return from a write made by a subscriber")
+	}
+
+	assert.Equal(t, []string{"request", "follow up", "reply"}, names(waitForEvents(t, store, &r, 3)))
+}
+
+func testOrdering(t *testing.T, store goes.EventStore) {
+	const writers, writes = 8, 25
+
+	var r recorder
+	publisher, publishes := store.(goes.EventPublisher)
+	if publishes {
+		publisher.SubscribeEvents(r.callback)
+	}
+
+	//Concurrent writers each append to their own aggregate, one event at a time. The
+	//aggregates are created here, as newAggregate must not fail the test from another
+	//goroutine.
+	aggs := make([]*goes.Aggregate, writers)
+	for w := range aggs {
+		aggs[w] = newAggregate(t)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int, agg *goes.Aggregate) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				addEvents(agg, fmt.Sprintf("%d-%d", w, i))
+				if err := store.StoreEvents(agg); err != nil {
+					t.Errorf("Storing events for %s: %v", agg.AggregateID, err)
+					return
+				}
+				agg.Events = nil
+			}
+		}(w, aggs[w])
+	}
+	wg.Wait()
+
+	if !publishes {
+		return
+	}
+
+	//Events are published in the order they were stored for each aggregate
+	published := waitForEvents(t, store, &r, writers*writes)
+	assert.Equal(t, writers*writes, len(published))
+	versions := make(map[string]int)
+	for _, e := range published {
+		assert.Equal(t, versions[e.Source]+1, e.Version, "Events for %s published out of order", e.Source)
+		versions[e.Source] = e.Version
+	}
+
+	//If the store keeps a global log, events are published in log order
+	logReader, ok := store.(goes.EventLogReader)
+	if !ok {
+		return
+	}
+
+	logged, err := logReader.ReadEventLog(1, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, len(published), len(logged)) {
+		for i := range logged {
+			assert.Equal(t, logged[i].EventID, published[i].EventID, "Event %d published out of log order", i)
+			assert.Equal(t, int64(i+1), logged[i].Position)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package goes
+
+import (
+	"fmt"
+	"time"
+)
+
+//VersionAt returns the version the aggregate had reached at the given time, judged by
+//the timestamps the store recorded for its events, or zero if it had no events then.
+//The aggregate's history up to the first event recorded after the time is counted, so
+//the version always marks a prefix of the history. An event with no timestamp returns
+//an error wrapping ErrMissingTimestamp.
+func VersionAt(store EventStore, aggregateID string, at time.Time) (int, error) {
+	events, err := store.RetrieveEvents(aggregateID)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	for _, e := range events {
+		if e.Timestamp.IsZero() {
+			return 0, fmt.Errorf("%w: aggregate %s version %d", ErrMissingTimestamp, aggregateID, e.Version)
+		}
+		if e.Timestamp.After(at) {
+			break
+		}
+		version = e.Version
+	}
+
+	return version, nil
+}
+
+//LoadAtVersion creates the aggregate with the given id and applies its event history
+//up to and including the given version, using the latest snapshot if it was taken at
+//or before that version. An error wrapping ErrVersionNotFound is returned if the
+//aggregate has not reached the version.
+func (r *Repository[T]) LoadAtVersion(aggregateID string, version int) (T, error) {
+	var zero T
+	if version < 1 {
+		return zero, fmt.Errorf("%w: aggregate %s version %d", ErrVersionNotFound, aggregateID, version)
+	}
+
+	agg, err := r.load(aggregateID, version)
+	if err != nil {
+		return zero, err
+	}
+
+	if agg.AggregateRoot().Version != version {
+		return zero, fmt.Errorf("%w: aggregate %s is at version %d, before version %d",
+			ErrVersionNotFound, aggregateID, agg.AggregateRoot().Version, version)
+	}
+
+	return agg, nil
+}
+
+//LoadAsOf creates the aggregate with the given id as it was at the given time, applying
+//the events recorded up to then. An error wrapping ErrAggregateNotFound is returned if
+//the aggregate had no events at that time.
+func (r *Repository[T]) LoadAsOf(aggregateID string, at time.Time) (T, error) {
+	var zero T
+
+	version, err := VersionAt(r.store, aggregateID, at)
+	if err != nil {
+		return zero, err
+	}
+	if version == 0 {
+		return zero, fmt.Errorf("%w: aggregate %s had no events at %s",
+			ErrAggregateNotFound, aggregateID, at.Format(time.RFC3339Nano))
+	}
+
+	return r.LoadAtVersion(aggregateID, version)
+}
+
+//History returns every state the aggregate with the given id has been in, one for each
+//stored version in order, for debugging and auditing. The history is replayed once,
+//copying the aggregate after each version with the function given to WithClone or, if
+//there is none, through a snapshot if the aggregate implements Snapshotter. An error
+//wrapping ErrNotCloneable is returned if the aggregate cannot be copied either way.
+func (r *Repository[T]) History(aggregateID string) ([]T, error) {
+	agg := r.factory()
+	root := agg.AggregateRoot()
+	root.AggregateID = aggregateID
+	root.Version = 0
+
+	if r.clone == nil {
+		if _, ok := any(agg).(Snapshotter); !ok {
+			return nil, fmt.Errorf("%w: aggregate %s has no clone function and cannot be snapshotted",
+				ErrNotCloneable, aggregateID)
+		}
+	}
+
+	events, _, err := r.readEvents(aggregateID, RangeQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	var states []T
+	for i, e := range events {
+		root.Version++
+		if err := agg.Route(e); err != nil {
+			return nil, err
+		}
+
+		//Events split by upcasting share their stored version, and make one state
+		if i+1 < len(events) && events[i+1].Version == e.Version {
+			continue
+		}
+
+		state, err := r.copyState(agg)
+		if err != nil {
+			return nil, err
+		}
+		state.AggregateRoot().Version = e.Version
+		state.AggregateRoot().Events = nil
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+//copyState returns a copy of the aggregate, made with the clone function if there is
+//one, or by restoring a snapshot of it into a new aggregate.
+func (r *Repository[T]) copyState(agg T) (T, error) {
+	if r.clone != nil {
+		return r.clone(agg), nil
+	}
+
+	var zero T
+	snapshot, err := any(agg).(Snapshotter).Snapshot()
+	if err != nil {
+		return zero, err
+	}
+
+	state := r.factory()
+	if err := any(state).(Snapshotter).RestoreSnapshot(snapshot); err != nil {
+		return zero, err
+	}
+	state.AggregateRoot().AggregateID = agg.AggregateRoot().AggregateID
+	return state, nil
+}
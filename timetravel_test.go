@@ -0,0 +1,147 @@
+package goes_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtracdev/goes"
+	"github.com/xtracdev/goes/inmems"
+	"github.com/xtracdev/goes/sample"
+	"github.com/xtracdev/goes/sample/testagg"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//saveUserHistory saves a user renamed to each of the given names, with one event a day
+//starting at epoch.
+func saveUserHistory(t *testing.T, repo *goes.Repository[*sample.User], names ...string) *sample.User {
+	user, err := sample.NewUser("first", "last", "email")
+	assert.Nil(t, err)
+	for _, name := range names {
+		assert.Nil(t, user.UpdateFirstName(name))
+	}
+	for i := range user.Events {
+		user.Events[i].Timestamp = epoch.Add(time.Duration(i) * 24 * time.Hour)
+	}
+	assert.Nil(t, repo.Save(user))
+	return user
+}
+
+func TestLoadAtVersion(t *testing.T) {
+	repo := sample.NewUserRepository(inmemes.NewInMemoryEventStore())
+	user := saveUserHistory(t, repo, "second", "third")
+
+	loaded, err := repo.LoadAtVersion(user.AggregateID, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, loaded.Version)
+	assert.Equal(t, "second", loaded.FirstName)
+
+	_, err = repo.LoadAtVersion(user.AggregateID, 4)
+	assert.True(t, errors.Is(err, goes.ErrVersionNotFound))
+	_, err = repo.LoadAtVersion(user.AggregateID, 0)
+	assert.True(t, errors.Is(err, goes.ErrVersionNotFound))
+}
+
+func TestLoadAsOf(t *testing.T) {
+	repo := sample.NewUserRepository(inmemes.NewInMemoryEventStore())
+	user := saveUserHistory(t, repo, "second", "third")
+
+	loaded, err := repo.LoadAsOf(user.AggregateID, epoch.Add(36*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, loaded.Version)
+	assert.Equal(t, "second", loaded.FirstName)
+
+	loaded, err = repo.LoadAsOf(user.AggregateID, epoch.Add(48*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "third", loaded.FirstName)
+
+	_, err = repo.LoadAsOf(user.AggregateID, epoch.Add(-time.Second))
+	assert.True(t, errors.Is(err, goes.ErrAggregateNotFound))
+}
+
+//untimedStore is an event store that does not record event timestamps.
+type untimedStore struct{}
+
+func (untimedStore) StoreEvents(*goes.Aggregate) error {
+	return nil
+}
+
+func (untimedStore) RetrieveEvents(aggID string) ([]goes.Event, error) {
+	return []goes.Event{{Source: aggID, Version: 1}}, nil
+}
+
+func TestVersionAtMissingTimestamp(t *testing.T) {
+	_, err := goes.VersionAt(untimedStore{}, "agg", epoch)
+	assert.True(t, errors.Is(err, goes.ErrMissingTimestamp))
+}
+
+func TestHistory(t *testing.T) {
+	repo := sample.NewUserRepository(inmemes.NewInMemoryEventStore())
+	user := saveUserHistory(t, repo, "second", "third")
+
+	states, err := repo.History(user.AggregateID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(states)) {
+		for i, name := range []string{"first", "second", "third"} {
+			assert.Equal(t, i+1, states[i].Version)
+			assert.Equal(t, name, states[i].FirstName)
+		}
+	}
+}
+
+func TestLoadAtVersionBeforeSnapshot(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	repo := testagg.NewTestAggRepository(store).WithSnapshots(inmemes.NewInMemorySnapshotStore(), goes.EveryNEvents(5))
+
+	ta, _ := testagg.NewTestAgg("foo", "bar", "baz")
+	assert.Nil(t, repo.Save(ta))
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, repo.Update(ta.AggregateID, func(agg *testagg.TestAgg) error {
+			return agg.UpdateFoo(fmt.Sprintf("foo %d", i))
+		}))
+	}
+
+	//Version 3 is before the snapshot at version 5, so is replayed from the start
+	loaded, err := repo.LoadAtVersion(ta.AggregateID, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo 1", loaded.Foo)
+
+	loaded, err = repo.LoadAtVersion(ta.AggregateID, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo 5", loaded.Foo)
+}
+
+func TestHistoryNeedsCopies(t *testing.T) {
+	store := inmemes.NewInMemoryEventStore()
+	user := saveUserHistory(t, sample.NewUserRepository(store), "second")
+
+	repo := goes.NewRepository(store, func() *sample.User {
+		return &sample.User{Aggregate: new(goes.Aggregate)}
+	}).WithCodec(sample.Codecs)
+	_, err := repo.History(user.AggregateID)
+	assert.True(t, errors.Is(err, goes.ErrNotCloneable))
+}
+
+func TestHistoryFromSnapshots(t *testing.T) {
+	repo := testagg.NewTestAggRepository(inmemes.NewInMemoryEventStore())
+	ta, _ := testagg.NewTestAgg("foo", "bar", "baz")
+	assert.Nil(t, repo.Save(ta))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, repo.Update(ta.AggregateID, func(agg *testagg.TestAgg) error {
+			return agg.UpdateFoo(fmt.Sprintf("foo %d", i))
+		}))
+	}
+
+	states, err := repo.History(ta.AggregateID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 4, len(states)) {
+		for i, foo := range []string{"foo", "foo 0", "foo 1", "foo 2"} {
+			assert.Equal(t, i+1, states[i].Version)
+			assert.Equal(t, foo, states[i].Foo)
+			assert.Equal(t, ta.AggregateID, states[i].AggregateID)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package goes
+
+import (
+	"fmt"
+	"sync"
+)
+
+//Upcaster transforms a serialized event written with an older payload schema. It
+//returns the event rewritten to a later schema version, several events if the old
+//event is split, or none if the event is dropped. Each event returned must have a
+//different type code or a higher schema version than the event given. The chain gives
+//every event returned the Source, Version, Position and Timestamp of the stored event,
+//so upcasters may build fresh events.
+type Upcaster func(Event) ([]Event, error)
+
+type upcasterKey struct {
+	typeCode      string
+	schemaVersion int
+}
+
+//UpcasterChain holds the upcasters for each type code and schema version. Events read
+//from a store are passed through the chain, with each upcaster's output upcast again,
+//until no upcaster is registered for the resulting type code and schema version.
+type UpcasterChain struct {
+	sync.RWMutex
+	upcasters map[upcasterKey]Upcaster
+}
+
+//NewUpcasterChain creates an empty UpcasterChain.
+func NewUpcasterChain() *UpcasterChain {
+	return &UpcasterChain{
+		upcasters: make(map[upcasterKey]Upcaster),
+	}
+}
+
+//Register adds the upcaster for events with the given type code and schema version.
+func (c *UpcasterChain) Register(typeCode string, schemaVersion int, upcaster Upcaster) {
+	c.Lock()
+	defer c.Unlock()
+	c.upcasters[upcasterKey{typeCode, schemaVersion}] = upcaster
+}
+
+//Upcast passes the event through the chain, returning the events it becomes in the
+//current schema. Events with no upcaster registered are returned unchanged.
+func (c *UpcasterChain) Upcast(event Event) ([]Event, error) {
+	c.RLock()
+	upcaster, ok := c.upcasters[upcasterKey{event.TypeCode, event.SchemaVersion}]
+	c.RUnlock()
+	if !ok {
+		return []Event{event}, nil
+	}
+
+	next, err := upcaster(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var upcast []Event
+	for _, e := range next {
+		e.Source = event.Source
+		e.Version = event.Version
+		e.Position = event.Position
+		e.Timestamp = event.Timestamp
+
+		if e.TypeCode == event.TypeCode && e.SchemaVersion <= event.SchemaVersion {
+			return nil, fmt.Errorf("Upcaster for %s schema version %d did not advance the schema version",
+				event.TypeCode, event.SchemaVersion)
+		}
+
+		current, err := c.Upcast(e)
+		if err != nil {
+			return nil, err
+		}
+		upcast = append(upcast, current...)
+	}
+
+	return upcast, nil
+}
+
+//UpcastEvents upcasts each of the events, returning the combined result.
+func (c *UpcasterChain) UpcastEvents(events []Event) ([]Event, error) {
+	var upcast []Event
+	for _, e := range events {
+		current, err := c.Upcast(e)
+		if err != nil {
+			return nil, err
+		}
+		upcast = append(upcast, current...)
+	}
+	return upcast, nil
+}
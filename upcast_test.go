@@ -0,0 +1,96 @@
+package goes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpcastRewritesThroughChain(t *testing.T) {
+	chain := NewUpcasterChain()
+	chain.Register("GREETED", 0, func(e Event) ([]Event, error) {
+		e.Payload = []byte(`{"Name":"` + string(e.Payload.([]byte)) + `"}`)
+		e.SchemaVersion = 1
+		return []Event{e}, nil
+	})
+	chain.Register("GREETED", 1, func(e Event) ([]Event, error) {
+		e.SchemaVersion = 2
+		return []Event{e}, nil
+	})
+
+	registry := NewTypeRegistry()
+	assert.Nil(t, registry.RegisterVersion("GREETED", 2, Greeted{}, JSONCodec{}))
+
+	upcast, err := chain.Upcast(Event{Source: "agg", Version: 1, TypeCode: "GREETED", Payload: []byte("joe")})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(upcast)) {
+		assert.Equal(t, 2, upcast[0].SchemaVersion)
+		decoded, err := registry.DecodeEvent(upcast[0])
+		assert.Nil(t, err)
+		assert.Equal(t, Greeted{Name: "joe"}, decoded.Payload)
+	}
+}
+
+func TestUpcastSplitsAndDrops(t *testing.T) {
+	chain := NewUpcasterChain()
+	chain.Register("GREETED_AND_WAVED", 0, func(e Event) ([]Event, error) {
+		greeted, waved := e, e
+		greeted.TypeCode = "GREETED"
+		waved.TypeCode = "WAVED"
+		return []Event{greeted, waved}, nil
+	})
+	chain.Register("NODDED", 0, func(e Event) ([]Event, error) {
+		return nil, nil
+	})
+
+	upcast, err := chain.UpcastEvents([]Event{
+		{Version: 1, TypeCode: "GREETED_AND_WAVED"},
+		{Version: 2, TypeCode: "NODDED"},
+		{Version: 3, TypeCode: "WAVED"},
+	})
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(upcast)) {
+		assert.Equal(t, "GREETED", upcast[0].TypeCode)
+		assert.Equal(t, "WAVED", upcast[1].TypeCode)
+		assert.Equal(t, 1, upcast[1].Version)
+		assert.Equal(t, 3, upcast[2].Version)
+	}
+}
+
+func TestUpcastKeepsStoredEventPlace(t *testing.T) {
+	chain := NewUpcasterChain()
+	chain.Register("GREETED_AND_WAVED", 0, func(e Event) ([]Event, error) {
+		return []Event{{TypeCode: "GREETED"}, {TypeCode: "WAVED"}}, nil
+	})
+
+	stored := Event{Source: "agg", Version: 2, Position: 7, TypeCode: "GREETED_AND_WAVED",
+		Timestamp: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	upcast, err := chain.Upcast(stored)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(upcast)) {
+		for _, e := range upcast {
+			assert.Equal(t, "agg", e.Source)
+			assert.Equal(t, 2, e.Version)
+			assert.Equal(t, int64(7), e.Position)
+			assert.Equal(t, stored.Timestamp, e.Timestamp)
+		}
+	}
+}
+
+func TestUpcastErrors(t *testing.T) {
+	chain := NewUpcasterChain()
+	chain.Register("GREETED", 0, func(e Event) ([]Event, error) {
+		return []Event{e}, nil
+	})
+	_, err := chain.Upcast(Event{TypeCode: "GREETED"})
+	assert.NotNil(t, err)
+
+	failed := errors.New("bad payload")
+	chain.Register("WAVED", 0, func(e Event) ([]Event, error) {
+		return nil, failed
+	})
+	_, err = chain.Upcast(Event{TypeCode: "WAVED"})
+	assert.Equal(t, failed, err)
+}